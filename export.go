@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/isabelroses/izrss/internal/config"
+	"github.com/isabelroses/izrss/internal/export"
+	"github.com/isabelroses/izrss/internal/rss"
+	"github.com/isabelroses/izrss/internal/storage"
+)
+
+// exportPosts exports the cached posts that match the command's filters.
+func exportPosts(cmd *ExportPostsCmd, cfg *config.Config, db *storage.DB, fetcher *rss.Fetcher) error {
+	format, err := export.ParseFormat(or(cmd.Format, cfg.Export.Format))
+	if err != nil {
+		return err
+	}
+
+	var since time.Time
+	if cmd.Since != "" {
+		since, err = time.ParseInLocation(time.DateOnly, cmd.Since, time.Local)
+		if err != nil {
+			return fmt.Errorf("parsing --since: %w", err)
+		}
+	}
+
+	feeds := fetcher.GetAllContent(context.Background(), cfg.FeedURLs(), rss.PreferCache)
+	if err := feeds.ReadTracking(db); err != nil {
+		return fmt.Errorf("reading tracking data: %w", err)
+	}
+
+	var posts []rss.Post
+	for _, feed := range feeds {
+		if !matchesFeed(feed, cmd.Feed) {
+			continue
+		}
+		for _, post := range feed.Posts {
+			if (cmd.Unread && post.Read) || post.Published.Before(since) {
+				continue
+			}
+			posts = append(posts, post)
+		}
+	}
+	rss.SortPosts(posts)
+
+	path, err := export.Write(posts, format, or(cmd.Output, cfg.Export.Dir), cmd.Title)
+	if err != nil {
+		return fmt.Errorf("exporting posts: %w", err)
+	}
+
+	fmt.Printf("Exported %d posts to %s\n", len(posts), path)
+	return nil
+}
+
+// matchesFeed reports whether feed is one of those picked by URL or title, or
+// whether none were picked.
+func matchesFeed(feed rss.Feed, picked []string) bool {
+	if len(picked) == 0 {
+		return true
+	}
+	for _, p := range picked {
+		if p == feed.URL || p == feed.Title {
+			return true
+		}
+	}
+	return false
+}
+
+func or(s, fallback string) string {
+	if s != "" {
+		return s
+	}
+	return fallback
+}
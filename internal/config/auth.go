@@ -0,0 +1,81 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Auth contains the credentials sent when fetching a feed. Secrets can be
+// given as is, read from an environment variable, or taken from the first
+// line a command prints, e.g. "pass show feeds/example". Commands are run
+// with sh, so they need a POSIX shell.
+type Auth struct {
+	Username        string `toml:"username"`
+	Password        string `toml:"password"`
+	PasswordEnv     string `toml:"password_env"`
+	PasswordCommand string `toml:"password_command"`
+	// Token is sent as a bearer token, in place of a username and password
+	Token        string `toml:"token"`
+	TokenEnv     string `toml:"token_env"`
+	TokenCommand string `toml:"token_command"`
+	// Headers are sent as they are, after expanding environment variables
+	Headers map[string]string `toml:"headers"`
+}
+
+// isSet reports whether any credentials or headers are configured
+func (a Auth) isSet() bool {
+	return a.Username != "" || a.Password != "" || a.PasswordEnv != "" || a.PasswordCommand != "" ||
+		a.Token != "" || a.TokenEnv != "" || a.TokenCommand != "" || len(a.Headers) > 0
+}
+
+// Resolve returns the auth with its password and token read from wherever
+// they are configured to come from, and its headers expanded.
+func (a Auth) Resolve() (Auth, error) {
+	password, err := secret("password", a.Password, a.PasswordEnv, a.PasswordCommand)
+	if err != nil {
+		return Auth{}, err
+	}
+	token, err := secret("token", a.Token, a.TokenEnv, a.TokenCommand)
+	if err != nil {
+		return Auth{}, err
+	}
+
+	var headers map[string]string
+	if len(a.Headers) > 0 {
+		headers = make(map[string]string, len(a.Headers))
+		for name, value := range a.Headers {
+			headers[name] = os.ExpandEnv(value)
+		}
+	}
+
+	return Auth{Username: a.Username, Password: password, Token: token, Headers: headers}, nil
+}
+
+// secret reads a secret from the first of value, env and command that is set.
+func secret(name, value, env, command string) (string, error) {
+	switch {
+	case value != "":
+		return value, nil
+	case env != "":
+		v, ok := os.LookupEnv(env)
+		if !ok {
+			return "", fmt.Errorf("reading %s: $%s is not set", name, env)
+		}
+		return v, nil
+	case command != "":
+		var stderr bytes.Buffer
+		cmd := exec.Command("sh", "-c", command)
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return "", fmt.Errorf("reading %s from %q: %w: %s", name, command, err, strings.TrimSpace(stderr.String()))
+		}
+		line, _, _ := strings.Cut(string(out), "\n")
+		return strings.TrimRight(line, "\r"), nil
+	default:
+		return "", nil
+	}
+}
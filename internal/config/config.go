@@ -4,6 +4,9 @@ package config
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/adrg/xdg"
 	"github.com/pelletier/go-toml/v2"
@@ -14,15 +17,127 @@ type Config struct {
 	Home       string   `toml:"home"`
 	DateFormat string   `toml:"dateformat"`
 	Urls       []string `toml:"urls"`
+	Feeds      []Feed   `toml:"feeds"`
+	Rules      []Rule   `toml:"rules"`
+	Searches   []Search `toml:"searches"`
 	Reader     Reader   `toml:"reader"`
+	List       List     `toml:"list"`
+	Media      Media    `toml:"media"`
+	Commands   Commands `toml:"commands"`
+	Export     Export   `toml:"export"`
+	Network    Network  `toml:"network"`
 	Colors     Colors   `toml:"colors"`
 }
 
+// Feed contains per-feed configuration. Feeds listed here are followed along
+// with those in Urls.
+type Feed struct {
+	URL string `toml:"url"`
+	// Command is run in place of fetching a URL, for following what has no
+	// feed: it prints an RSS, Atom or JSON feed. Timeout is how long in
+	// seconds it may run.
+	Command     string `toml:"command"`
+	Timeout     int    `toml:"timeout"`
+	Readability bool   `toml:"readability"`
+	// Proxy overrides the network proxy for this feed, "none" fetches it
+	// directly
+	Proxy string `toml:"proxy"`
+	Auth  Auth   `toml:"auth"`
+	// Rules run over this feed's posts after the global rules
+	Rules []Rule `toml:"rules"`
+}
+
+// Rule acts on the posts that match a regular expression
+type Rule struct {
+	Match string `toml:"match"`
+	// Field is what is matched: "title", "content", "author" or
+	// "category", by default any of them
+	Field string `toml:"field"`
+	// Action is "drop", "read", "star" or "rewrite"
+	Action string `toml:"action"`
+	// Replace is what "rewrite" replaces matches in the title with
+	Replace string `toml:"replace"`
+}
+
+// Search is a search query listed on the home view as a feed of its own
+type Search struct {
+	Name  string `toml:"name"`
+	Query string `toml:"query"`
+}
+
 // Reader contains reader-specific configuration
 type Reader struct {
 	Size          any     `toml:"size"`
 	Theme         string  `toml:"theme"`
+	ImageProtocol string  `toml:"image_protocol"`
 	ReadThreshold float64 `toml:"read_threshold"`
+	Images        bool    `toml:"images"`
+	// ExternalFormat is how posts are written out for $PAGER and $EDITOR:
+	// "markdown" or "html"
+	ExternalFormat string `toml:"external_format"`
+}
+
+// List contains configuration for the post lists
+type List struct {
+	MarkReadOnScroll bool `toml:"mark_read_on_scroll"`
+	OlderThanDays    int  `toml:"older_than_days"`
+}
+
+// Media contains configuration for podcast and other media enclosures
+type Media struct {
+	// Player is the command enclosures are played with; the URL is appended
+	Player      string `toml:"player"`
+	DownloadDir string `toml:"download_dir"`
+}
+
+// Commands contains the external commands izrss runs. Commands are split
+// into arguments like a shell would, without running one, and "{link}",
+// "{title}", "{feed}" and "{feed_url}" are replaced with the post's details.
+type Commands struct {
+	// Open is the command links are opened with, by default the system's
+	Open    string             `toml:"open"`
+	Actions map[string]Command `toml:"actions"`
+}
+
+// Command is a named action bound to a key in the post lists and reader
+type Command struct {
+	Key string `toml:"key"`
+	Run string `toml:"run"`
+	// Input is what is written to the command's stdin: "markdown", "html" or
+	// nothing
+	Input string `toml:"input"`
+	// Interactive commands take over the terminal until they exit, like a
+	// pager; others run in the background
+	Interactive bool `toml:"interactive"`
+}
+
+// Export contains the defaults for exporting posts
+type Export struct {
+	// Format is "markdown", "html" or "epub"
+	Format string `toml:"format"`
+	Dir    string `toml:"dir"`
+}
+
+// Network contains configuration for how feeds, images and downloads are
+// fetched
+type Network struct {
+	UserAgent string `toml:"user_agent"`
+	// Proxy is an http, https or socks5 proxy URL, by default the proxy is
+	// taken from the environment
+	Proxy string `toml:"proxy"`
+	// ConnectTimeout and ReadTimeout are in seconds
+	ConnectTimeout int `toml:"connect_timeout"`
+	ReadTimeout    int `toml:"read_timeout"`
+	// CABundle is a PEM file of extra certificates to trust
+	CABundle string `toml:"ca_bundle"`
+	// Insecure skips verifying certificates, for self-signed servers
+	Insecure bool `toml:"insecure"`
+	// Retries is how many times a failed request is retried
+	Retries int `toml:"retries"`
+	// PerHost is how many feeds are fetched from one host at once, and
+	// HostDelay the least time in seconds between starting them
+	PerHost   int     `toml:"per_host"`
+	HostDelay float64 `toml:"host_delay"`
 }
 
 // Colors contains UI color configuration
@@ -41,9 +156,30 @@ func Default() *Config {
 		DateFormat: "02/01/2006",
 		Urls:       []string{},
 		Reader: Reader{
-			Size:          "recomended",
-			ReadThreshold: 0.8,
-			Theme:         "",
+			Size:           "recomended",
+			ReadThreshold:  0.8,
+			Theme:          "",
+			Images:         true,
+			ImageProtocol:  "auto",
+			ExternalFormat: "markdown",
+		},
+		List: List{
+			MarkReadOnScroll: false,
+			OlderThanDays:    30,
+		},
+		Media: Media{
+			Player:      "mpv",
+			DownloadDir: filepath.Join(xdg.UserDirs.Download, "izrss"),
+		},
+		Export: Export{
+			Format: "markdown",
+			Dir:    filepath.Join(xdg.UserDirs.Documents, "izrss"),
+		},
+		Network: Network{
+			ConnectTimeout: 10,
+			ReadTimeout:    20,
+			Retries:        2,
+			PerHost:        2,
 		},
 		Colors: Colors{
 			Text:       "#cdd6f4",
@@ -77,9 +213,109 @@ func Load(path string) (*Config, error) {
 		return nil, fmt.Errorf("parsing config file: %w", err)
 	}
 
+	for i, feed := range cfg.Feeds {
+		switch {
+		case feed.URL == "" && feed.Command == "":
+			return nil, fmt.Errorf("feed %d needs a url or a command", i+1)
+		case feed.URL != "" && feed.Command != "":
+			return nil, fmt.Errorf("feed %s has both a url and a command %q", feed.URL, feed.Command)
+		// Commands fetch their own feeds, so a proxy or credentials would
+		// never be used
+		case feed.Command != "" && feed.Proxy != "":
+			return nil, fmt.Errorf("feed %q is a command, which can't have a proxy", feed.Command)
+		case feed.Command != "" && feed.Auth.isSet():
+			return nil, fmt.Errorf("feed %q is a command, which can't have auth", feed.Command)
+		}
+	}
+
+	names := make(map[string]bool, len(cfg.Searches))
+	for _, search := range cfg.Searches {
+		if search.Name == "" || search.Query == "" {
+			return nil, fmt.Errorf("each search needs a name and a query")
+		}
+		if names[search.Name] {
+			return nil, fmt.Errorf("there is more than one search named %q", search.Name)
+		}
+		names[search.Name] = true
+	}
+
+	cfg.Media.DownloadDir = expandHome(cfg.Media.DownloadDir)
+	cfg.Export.Dir = expandHome(cfg.Export.Dir)
+	cfg.Network.CABundle = expandHome(cfg.Network.CABundle)
+
 	return cfg, nil
 }
 
+// expandHome expands a leading "~" in a path to the user's home directory
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	return filepath.Join(xdg.Home, path[1:])
+}
+
+// FeedURLs returns the URL of every followed feed, those in Urls first
+func (c *Config) FeedURLs() []string {
+	urls := make([]string, 0, len(c.Urls)+len(c.Feeds))
+	seen := make(map[string]bool, cap(urls))
+	for _, url := range c.Urls {
+		if !seen[url] {
+			seen[url] = true
+			urls = append(urls, url)
+		}
+	}
+	for _, feed := range c.Feeds {
+		if url := feed.Source(); !seen[url] {
+			seen[url] = true
+			urls = append(urls, url)
+		}
+	}
+	return urls
+}
+
+// FeedProxies returns the feeds with a proxy of their own, by URL
+func (c *Config) FeedProxies() map[string]string {
+	proxies := make(map[string]string)
+	for _, feed := range c.Feeds {
+		if feed.Proxy != "" {
+			proxies[feed.Source()] = feed.Proxy
+		}
+	}
+	return proxies
+}
+
+// Feed returns the settings for the feed at url, or the zero Feed if it has
+// none
+func (c *Config) Feed(url string) Feed {
+	for _, feed := range c.Feeds {
+		if feed.Source() == url {
+			return feed
+		}
+	}
+	return Feed{URL: url}
+}
+
+// Source is where the feed is fetched from: its URL, or for a command an
+// "exec:" URL running it
+func (f Feed) Source() string {
+	if f.Command != "" {
+		return "exec:" + f.Command
+	}
+	return f.URL
+}
+
+// CommandTimeouts returns the timeouts of the command feeds that set one, by
+// their source
+func (c *Config) CommandTimeouts() map[string]time.Duration {
+	timeouts := make(map[string]time.Duration)
+	for _, feed := range c.Feeds {
+		if feed.Command != "" && feed.Timeout > 0 {
+			timeouts[feed.Source()] = time.Duration(feed.Timeout) * time.Second
+		}
+	}
+	return timeouts
+}
+
 func configFile(file string) (string, error) {
 	configFile, err := xdg.ConfigFile("izrss/" + file)
 	if err != nil {
@@ -3,7 +3,11 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/adrg/xdg"
 )
 
 func TestDefault(t *testing.T) {
@@ -64,6 +68,10 @@ size = "large"
 theme = "dark"
 read_threshold = 0.9
 
+[list]
+mark_read_on_scroll = true
+older_than_days = 7
+
 [colors]
 text = "#ffffff"
 inverttext = "#000000"
@@ -106,6 +114,14 @@ borders = "#333333"
 		t.Errorf("Expected Reader.ReadThreshold 0.9, got %f", cfg.Reader.ReadThreshold)
 	}
 
+	if !cfg.List.MarkReadOnScroll {
+		t.Error("Expected List.MarkReadOnScroll to be true")
+	}
+
+	if cfg.List.OlderThanDays != 7 {
+		t.Errorf("Expected List.OlderThanDays 7, got %d", cfg.List.OlderThanDays)
+	}
+
 	if cfg.Colors.Accent != "#ff0000" {
 		t.Errorf("Expected Colors.Accent '#ff0000', got %q", cfg.Colors.Accent)
 	}
@@ -256,4 +272,306 @@ func TestReaderDefaults(t *testing.T) {
 	if cfg.Reader.Theme != "" {
 		t.Errorf("Expected empty Theme, got %q", cfg.Reader.Theme)
 	}
+
+	if !cfg.Reader.Images {
+		t.Error("Expected Images to be on by default")
+	}
+
+	if cfg.Reader.ImageProtocol != "auto" {
+		t.Errorf("Expected ImageProtocol 'auto', got %q", cfg.Reader.ImageProtocol)
+	}
+
+	if cfg.Reader.ExternalFormat != "markdown" {
+		t.Errorf("Expected ExternalFormat 'markdown', got %q", cfg.Reader.ExternalFormat)
+	}
+}
+
+func TestListDefaults(t *testing.T) {
+	cfg := Default()
+
+	if cfg.List.MarkReadOnScroll {
+		t.Error("Expected MarkReadOnScroll to be off by default")
+	}
+
+	if cfg.List.OlderThanDays != 30 {
+		t.Errorf("Expected OlderThanDays 30, got %d", cfg.List.OlderThanDays)
+	}
+}
+
+func TestFeeds(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "izrss-config-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer func() { _ = os.RemoveAll(tmpDir) }()
+
+	configPath := filepath.Join(tmpDir, "config.toml")
+	configContent := `
+urls = ["http://example.com/feed", "http://example.org/rss"]
+
+[[feeds]]
+url = "http://example.org/rss"
+readability = true
+
+[[feeds]]
+url = "http://example.net/atom"
+
+[feeds.auth]
+username = "me"
+password_env = "FEED_PASSWORD"
+headers = { "X-Api-Key" = "key" }
+`
+
+	err = os.WriteFile(configPath, []byte(configContent), 0o644)
+	if err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	cfg, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	urls := cfg.FeedURLs()
+	want := []string{"http://example.com/feed", "http://example.org/rss", "http://example.net/atom"}
+	if len(urls) != len(want) {
+		t.Fatalf("Expected %d URLs, got %v", len(want), urls)
+	}
+	for i, w := range want {
+		if urls[i] != w {
+			t.Errorf("URL %d: expected %q, got %q", i, w, urls[i])
+		}
+	}
+
+	if !cfg.Feed("http://example.org/rss").Readability {
+		t.Error("Expected readability for http://example.org/rss")
+	}
+	if cfg.Feed("http://example.com/feed").Readability {
+		t.Error("Expected no readability for a feed without settings")
+	}
+
+	auth := cfg.Feed("http://example.net/atom").Auth
+	if auth.Username != "me" || auth.PasswordEnv != "FEED_PASSWORD" || auth.Headers["X-Api-Key"] != "key" {
+		t.Errorf("Expected the feed's auth settings, got %+v", auth)
+	}
+}
+
+func TestCommandFeeds(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.toml")
+	configContent := `
+[[feeds]]
+command = "gh api repos/owner/repo/releases.atom"
+timeout = 60
+
+[[feeds]]
+command = "./scrape.sh"
+`
+	if err := os.WriteFile(configPath, []byte(configContent), 0o644); err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+
+	cfg, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	urls := cfg.FeedURLs()
+	want := []string{"exec:gh api repos/owner/repo/releases.atom", "exec:./scrape.sh"}
+	if len(urls) != len(want) || urls[0] != want[0] || urls[1] != want[1] {
+		t.Errorf("Expected %v, got %v", want, urls)
+	}
+	if cfg.Feed(want[0]).Timeout != 60 {
+		t.Errorf("Expected the command feed's settings, got %+v", cfg.Feed(want[0]))
+	}
+
+	timeouts := cfg.CommandTimeouts()
+	if len(timeouts) != 1 || timeouts[want[0]] != time.Minute {
+		t.Errorf("Expected one command timeout, got %v", timeouts)
+	}
+
+	invalid := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"both", "[[feeds]]\nurl = \"http://example.com\"\ncommand = \"true\"\n", "http://example.com has both"},
+		{"neither", "[[feeds]]\nurl = \"http://example.com\"\n[[feeds]]\ntimeout = 5\n", "feed 2 needs a url or a command"},
+		{"proxy", "[[feeds]]\ncommand = \"true\"\nproxy = \"none\"\n", "can't have a proxy"},
+		{"auth", "[[feeds]]\ncommand = \"true\"\n[feeds.auth]\ntoken = \"secret\"\n", "can't have auth"},
+	}
+	for _, tt := range invalid {
+		path := filepath.Join(tmpDir, tt.name+".toml")
+		if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+			t.Fatalf("Failed to write test config: %v", err)
+		}
+		if _, err := Load(path); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: expected an error containing %q, got %v", tt.name, tt.want, err)
+		}
+	}
+}
+
+func TestRules(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.toml")
+	configContent := `
+[[rules]]
+match = "(?i)sponsored"
+field = "title"
+action = "drop"
+
+[[feeds]]
+url = "https://github.com/notifications.atom"
+
+[[feeds.rules]]
+match = "dependabot"
+field = "author"
+action = "read"
+`
+	if err := os.WriteFile(configPath, []byte(configContent), 0o644); err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+
+	cfg, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	if len(cfg.Rules) != 1 || cfg.Rules[0] != (Rule{Match: "(?i)sponsored", Field: "title", Action: "drop"}) {
+		t.Errorf("Expected the global rule, got %+v", cfg.Rules)
+	}
+	rules := cfg.Feed("https://github.com/notifications.atom").Rules
+	if len(rules) != 1 || rules[0].Action != "read" || rules[0].Field != "author" {
+		t.Errorf("Expected the feed's rule, got %+v", rules)
+	}
+}
+
+func TestSearches(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.toml")
+	configContent := `
+[[searches]]
+name = "unread rust"
+query = "rust is:unread"
+`
+	if err := os.WriteFile(configPath, []byte(configContent), 0o644); err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+
+	cfg, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(cfg.Searches) != 1 || cfg.Searches[0] != (Search{Name: "unread rust", Query: "rust is:unread"}) {
+		t.Errorf("Expected the search, got %+v", cfg.Searches)
+	}
+
+	for _, bad := range []string{
+		"[[searches]]\nname = \"no query\"\n",
+		"[[searches]]\nname = \"a\"\nquery = \"x\"\n[[searches]]\nname = \"a\"\nquery = \"y\"\n",
+	} {
+		if err := os.WriteFile(configPath, []byte(bad), 0o644); err != nil {
+			t.Fatalf("Failed to write test config: %v", err)
+		}
+		if _, err := Load(configPath); err == nil {
+			t.Errorf("Expected an error loading %q", bad)
+		}
+	}
+}
+
+func TestMedia(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.toml")
+	configContent := `
+[media]
+player = "mpv --no-video"
+download_dir = "~/Podcasts"
+`
+	if err := os.WriteFile(configPath, []byte(configContent), 0o644); err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+
+	cfg, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	if cfg.Media.Player != "mpv --no-video" {
+		t.Errorf("Expected the configured player, got %q", cfg.Media.Player)
+	}
+	if want := filepath.Join(xdg.Home, "Podcasts"); cfg.Media.DownloadDir != want {
+		t.Errorf("Expected download dir %q, got %q", want, cfg.Media.DownloadDir)
+	}
+}
+
+func TestNetwork(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.toml")
+	configContent := `
+[network]
+user_agent = "test-agent"
+read_timeout = 60
+ca_bundle = "~/ca.pem"
+
+[[feeds]]
+url = "http://example.onion/feed.xml"
+proxy = "socks5h://127.0.0.1:9050"
+
+[[feeds]]
+url = "https://example.com/feed.xml"
+`
+	if err := os.WriteFile(configPath, []byte(configContent), 0o644); err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+
+	cfg, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	if cfg.Network.UserAgent != "test-agent" || cfg.Network.ReadTimeout != 60 {
+		t.Errorf("Expected the configured network settings, got %+v", cfg.Network)
+	}
+	if cfg.Network.ConnectTimeout != 10 {
+		t.Errorf("Expected the default connect timeout, got %d", cfg.Network.ConnectTimeout)
+	}
+	if cfg.Network.Retries != 2 || cfg.Network.PerHost != 2 {
+		t.Errorf("Expected the default retries and per host limit, got %+v", cfg.Network)
+	}
+	if want := filepath.Join(xdg.Home, "ca.pem"); cfg.Network.CABundle != want {
+		t.Errorf("Expected CA bundle %q, got %q", want, cfg.Network.CABundle)
+	}
+
+	proxies := cfg.FeedProxies()
+	if len(proxies) != 1 || proxies["http://example.onion/feed.xml"] != "socks5h://127.0.0.1:9050" {
+		t.Errorf("Expected one feed proxy, got %v", proxies)
+	}
+}
+
+func TestAuthResolve(t *testing.T) {
+	t.Setenv("IZRSS_TEST_TOKEN", "from-env")
+
+	auth, err := Auth{
+		Username:        "me",
+		PasswordCommand: "printf 'hunter2\\nsecond line\\n'",
+		TokenEnv:        "IZRSS_TEST_TOKEN",
+		Headers:         map[string]string{"X-Token": "${IZRSS_TEST_TOKEN}"},
+	}.Resolve()
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+
+	if auth.Username != "me" || auth.Password != "hunter2" {
+		t.Errorf("Expected the first line of the command's output, got %q:%q", auth.Username, auth.Password)
+	}
+	if auth.Token != "from-env" || auth.Headers["X-Token"] != "from-env" {
+		t.Errorf("Expected the token and header from the environment, got %q, %v", auth.Token, auth.Headers)
+	}
+
+	if _, err := (Auth{TokenEnv: "IZRSS_TEST_UNSET"}).Resolve(); err == nil {
+		t.Error("Expected an error for an unset variable")
+	}
+	if _, err := (Auth{PasswordCommand: "exit 1"}).Resolve(); err == nil {
+		t.Error("Expected an error for a failing command")
+	}
 }
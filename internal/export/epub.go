@@ -0,0 +1,153 @@
+package export
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/isabelroses/izrss/internal/rss"
+)
+
+const containerXML = `<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>
+`
+
+// Book writes posts as an EPUB 3 book, a chapter per post, for reading on an
+// e-reader. modified is recorded as the book's last modification time.
+func Book(w io.Writer, title string, posts []rss.Post, modified time.Time) error {
+	z := zip.NewWriter(w)
+
+	// The mimetype must come first and be stored uncompressed, so readers can
+	// identify the file by its first bytes.
+	mimetype, err := z.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		return fmt.Errorf("writing epub: %w", err)
+	}
+	if _, err := io.WriteString(mimetype, "application/epub+zip"); err != nil {
+		return fmt.Errorf("writing epub: %w", err)
+	}
+
+	files := []struct{ name, content string }{
+		{"META-INF/container.xml", containerXML},
+		{"OEBPS/content.opf", packageDocument(title, posts, modified)},
+		{"OEBPS/nav.xhtml", navDocument(title, posts)},
+	}
+	for i, post := range posts {
+		files = append(files, struct{ name, content string }{
+			"OEBPS/" + chapterName(i), chapter(post),
+		})
+	}
+
+	for _, f := range files {
+		fw, err := z.Create(f.name)
+		if err != nil {
+			return fmt.Errorf("writing epub: %w", err)
+		}
+		if _, err := io.WriteString(fw, f.content); err != nil {
+			return fmt.Errorf("writing epub: %w", err)
+		}
+	}
+
+	if err := z.Close(); err != nil {
+		return fmt.Errorf("writing epub: %w", err)
+	}
+	return nil
+}
+
+func chapterName(i int) string {
+	return fmt.Sprintf("post-%d.xhtml", i+1)
+}
+
+// packageDocument is the book's OPF: its metadata, files and reading order.
+func packageDocument(title string, posts []rss.Post, modified time.Time) string {
+	// The identifier is derived from the posts, so exporting the same posts
+	// again updates the book in a library instead of adding a copy.
+	h := sha256.New()
+	for _, post := range posts {
+		_, _ = io.WriteString(h, post.Link+"\x00"+post.UUID+"\x00")
+	}
+	id := hex.EncodeToString(h.Sum(nil))[:32]
+
+	var manifest, spine strings.Builder
+	for i := range posts {
+		name := chapterName(i)
+		fmt.Fprintf(&manifest, "    <item id=\"post-%d\" href=\"%s\" media-type=\"application/xhtml+xml\"/>\n", i+1, name)
+		fmt.Fprintf(&spine, "    <itemref idref=\"post-%d\"/>\n", i+1)
+	}
+
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="book-id">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:identifier id="book-id">urn:izrss:%s</dc:identifier>
+    <dc:title>%s</dc:title>
+    <dc:language>en</dc:language>
+    <dc:creator>izrss</dc:creator>
+    <meta property="dcterms:modified">%s</meta>
+  </metadata>
+  <manifest>
+    <item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+%s  </manifest>
+  <spine>
+%s  </spine>
+</package>
+`, id, html.EscapeString(title), modified.UTC().Format("2006-01-02T15:04:05Z"), manifest.String(), spine.String())
+}
+
+// navDocument is the book's table of contents
+func navDocument(title string, posts []rss.Post) string {
+	var items strings.Builder
+	for i, post := range posts {
+		fmt.Fprintf(&items, "      <li><a href=\"%s\">%s</a></li>\n", chapterName(i), html.EscapeString(chapterTitle(post)))
+	}
+
+	return xhtml(title, fmt.Sprintf(`<nav epub:type="toc" id="toc">
+    <h1>%s</h1>
+    <ol>
+%s    </ol>
+  </nav>`, html.EscapeString(title), items.String()))
+}
+
+// chapter renders a post as an XHTML chapter. Remote images can't be shown in
+// an EPUB, so they are replaced with their alt text.
+func chapter(post rss.Post) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "<h1>%s</h1>\n", html.EscapeString(chapterTitle(post)))
+	if meta := byline(post); meta != "" {
+		fmt.Fprintf(&b, "<p><small>%s</small></p>\n", html.EscapeString(meta))
+	}
+	b.WriteString(clean(post.Content, post.Link, true))
+	if post.Link != "" {
+		fmt.Fprintf(&b, "\n<p><a href=\"%s\">%s</a></p>", html.EscapeString(post.Link), html.EscapeString(post.Link))
+	}
+	return xhtml(chapterTitle(post), b.String())
+}
+
+func chapterTitle(post rss.Post) string {
+	if post.Title == "" {
+		return "Untitled"
+	}
+	return post.Title
+}
+
+func xhtml(title, body string) string {
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops">
+<head>
+  <title>%s</title>
+</head>
+<body>
+  %s
+</body>
+</html>
+`, html.EscapeString(title), body)
+}
@@ -0,0 +1,225 @@
+// Package export writes posts out of izrss as Markdown, an HTML digest or an
+// EPUB book
+package export
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	tomd "github.com/JohannesKaufmann/html-to-markdown"
+
+	"github.com/isabelroses/izrss/internal/rss"
+)
+
+// Format is a way of exporting posts
+type Format string
+
+// The supported export formats
+const (
+	Markdown Format = "markdown"
+	HTML     Format = "html"
+	EPUB     Format = "epub"
+)
+
+// ParseFormat maps a config or flag value to a format
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(s)); f {
+	case Markdown, HTML, EPUB:
+		return f, nil
+	case "md":
+		return Markdown, nil
+	default:
+		return "", fmt.Errorf("unknown export format %q", s)
+	}
+}
+
+var converter = tomd.NewConverter("", true, nil)
+
+// ToMarkdown converts a post's HTML to markdown
+func ToMarkdown(content string) (string, error) {
+	md, err := converter.ConvertString(content)
+	if err != nil {
+		return "", fmt.Errorf("converting html to markdown: %w", err)
+	}
+	return md, nil
+}
+
+// Write exports posts in format under dest, which for Markdown is a directory
+// given a file per post. The other formats write a single file: dest itself if
+// it has the format's extension, else a file in dest named after title. It
+// returns the path written to.
+func Write(posts []rss.Post, format Format, dest, title string) (string, error) {
+	if len(posts) == 0 {
+		return "", fmt.Errorf("no posts to export")
+	}
+
+	if format == Markdown {
+		return dest, MarkdownFiles(posts, dest)
+	}
+
+	// A file named by the caller is replaced, while one named after the
+	// title is kept apart from earlier exports
+	var (
+		file *os.File
+		err  error
+	)
+	if ext := "." + string(format); strings.EqualFold(filepath.Ext(dest), ext) {
+		if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+			return "", fmt.Errorf("creating export directory: %w", err)
+		}
+		file, err = os.Create(dest)
+	} else {
+		if err := os.MkdirAll(dest, 0o755); err != nil {
+			return "", fmt.Errorf("creating export directory: %w", err)
+		}
+		file, err = createUnique(dest, slug(title), ext)
+	}
+	if err != nil {
+		return "", fmt.Errorf("creating export file: %w", err)
+	}
+	dest = file.Name()
+
+	switch format {
+	case HTML:
+		err = Digest(file, title, posts)
+	case EPUB:
+		err = Book(file, title, posts, time.Now())
+	default:
+		err = fmt.Errorf("unknown export format %q", format)
+	}
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(dest)
+		return "", err
+	}
+	return dest, nil
+}
+
+// MarkdownFiles writes each post to its own Markdown file in dir, named after
+// its date and title.
+func MarkdownFiles(posts []rss.Post, dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("creating export directory: %w", err)
+	}
+
+	for _, post := range posts {
+		name := slug(post.Title)
+		if !post.Published.IsZero() {
+			name = post.Published.Format("2006-01-02") + "-" + name
+		}
+
+		doc, err := Document(post, Markdown)
+		if err != nil {
+			return err
+		}
+		file, err := createUnique(dir, name, ".md")
+		if err != nil {
+			return fmt.Errorf("creating %s: %w", name, err)
+		}
+		_, err = io.WriteString(file, doc)
+		if cerr := file.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return fmt.Errorf("writing %s: %w", file.Name(), err)
+		}
+	}
+	return nil
+}
+
+// createUnique creates name+ext in dir, or name-2, name-3 and so on if that
+// is taken, so an earlier export is never overwritten.
+func createUnique(dir, name, ext string) (*os.File, error) {
+	for n := 1; ; n++ {
+		path := filepath.Join(dir, name+ext)
+		if n > 1 {
+			path = filepath.Join(dir, name+"-"+strconv.Itoa(n)+ext)
+		}
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if !errors.Is(err, fs.ErrExist) {
+			return file, err
+		}
+	}
+}
+
+// Document writes a single post out as Markdown, or as its HTML for the HTML
+// format, headed by its details as YAML front matter.
+func Document(post rss.Post, format Format) (string, error) {
+	if format == HTML {
+		return "<!--\n" + frontMatter(post, commentQuote) + "-->\n" + absolute(post.Content, post.Link), nil
+	}
+
+	md, err := ToMarkdown(absolute(post.Content, post.Link))
+	if err != nil {
+		return "", err
+	}
+	return frontMatter(post, strconv.Quote) + "\n" + md + "\n", nil
+}
+
+// commentQuote quotes a value for front matter inside an HTML comment, which
+// a "--" in a title could end. Its dashes are escaped as YAML reads them.
+func commentQuote(value string) string {
+	return strings.ReplaceAll(strconv.Quote(value), "--", `-\x2d`)
+}
+
+// frontMatter describes a post as a YAML front matter block, leaving out
+// fields it doesn't have. Values are quoted with quote.
+func frontMatter(post rss.Post, quote func(string) string) string {
+	var b strings.Builder
+	b.WriteString("---\n")
+
+	field := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(&b, "%s: %s\n", name, quote(value))
+		}
+	}
+	list := func(name string, values []string) {
+		if len(values) == 0 {
+			return
+		}
+		fmt.Fprintf(&b, "%s:\n", name)
+		for _, v := range values {
+			fmt.Fprintf(&b, "  - %s\n", quote(v))
+		}
+	}
+	date := func(name string, t time.Time) {
+		if !t.IsZero() {
+			field(name, t.Format(time.RFC3339))
+		}
+	}
+
+	field("title", post.Title)
+	field("feed", post.FeedTitle)
+	field("link", post.Link)
+	list("authors", post.Authors)
+	date("published", post.Published)
+	date("updated", post.Updated)
+	list("categories", post.Categories)
+
+	b.WriteString("---\n")
+	return b.String()
+}
+
+var nonSlug = regexp.MustCompile(`[^a-z0-9]+`)
+
+// slug turns a title into something safe and readable as a file name
+func slug(title string) string {
+	s := strings.Trim(nonSlug.ReplaceAllString(strings.ToLower(title), "-"), "-")
+	if len(s) > 60 {
+		s = strings.TrimRight(s[:60], "-")
+	}
+	if s == "" {
+		return "post"
+	}
+	return s
+}
@@ -0,0 +1,234 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/isabelroses/izrss/internal/rss"
+)
+
+func testPosts() []rss.Post {
+	return []rss.Post{
+		{
+			Title:     `A "quoted" post`,
+			FeedTitle: "Alpha",
+			Link:      "https://example.com/a",
+			Authors:   []string{"Ada"},
+			Published: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+			Content:   `<p onclick="evil()">Hello <em>world</em>&nbsp;<br><img src="https://example.com/x.png" alt="a chart"></p><script>alert(1)</script>`,
+		},
+		{
+			Title:   "A \"quoted\" post",
+			Content: "<p>Same title, no date</p>",
+		},
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for in, want := range map[string]Format{"markdown": Markdown, "MD": Markdown, "html": HTML, "epub": EPUB} {
+		if got, err := ParseFormat(in); err != nil || got != want {
+			t.Errorf("ParseFormat(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParseFormat("pdf"); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+}
+
+func TestDocument(t *testing.T) {
+	post := testPosts()[0]
+	post.Content = "<p>Hello <em>world</em></p>"
+
+	md, err := Document(post, Markdown)
+	if err != nil {
+		t.Fatalf("Document failed: %v", err)
+	}
+	for _, want := range []string{
+		"---\ntitle: \"A \\\"quoted\\\" post\"\n",
+		"feed: \"Alpha\"\n",
+		"authors:\n  - \"Ada\"\n",
+		"published: \"2026-01-02T03:04:05Z\"\n",
+		"---\n\nHello _world_\n",
+	} {
+		if !strings.Contains(md, want) {
+			t.Errorf("Expected markdown document to contain %q, got %q", want, md)
+		}
+	}
+	if strings.Contains(md, "updated:") || strings.Contains(md, "categories:") {
+		t.Errorf("Expected missing fields to be left out, got %q", md)
+	}
+
+	html, _ := Document(post, HTML)
+	if !strings.HasPrefix(html, "<!--\n---\n") || !strings.HasSuffix(html, "-->\n<p>Hello <em>world</em></p>") {
+		t.Errorf("Expected the raw HTML after commented front matter, got %q", html)
+	}
+
+	// A title can't end the comment early
+	post.Title = "A --> B <!-- c ---"
+	html, _ = Document(post, HTML)
+	comment, _, _ := strings.Cut(html, "\n---\n-->\n")
+	if strings.Contains(strings.TrimPrefix(comment, "<!--\n---\n"), "--") {
+		t.Errorf("Expected no -- in the commented front matter, got %q", html)
+	}
+	if !strings.Contains(html, `title: "A -\x2d> B <!-\x2d c -\x2d-"`) {
+		t.Errorf("Expected the title's dashes to be escaped, got %q", html)
+	}
+}
+
+func TestDocument_ResolvesLinks(t *testing.T) {
+	post := rss.Post{
+		Title:   "Relative",
+		Link:    "https://example.com/posts/1",
+		Content: `<p><a href="/about">About</a> <a href="#note">note</a> <img src="chart.png" alt="chart"></p>`,
+	}
+
+	md, err := Document(post, Markdown)
+	if err != nil {
+		t.Fatalf("Document failed: %v", err)
+	}
+	for _, want := range []string{"(https://example.com/about)", "(#note)", "(https://example.com/posts/chart.png)"} {
+		if !strings.Contains(md, want) {
+			t.Errorf("Expected markdown document to contain %q, got %q", want, md)
+		}
+	}
+
+	html, _ := Document(post, HTML)
+	for _, want := range []string{`href="https://example.com/about"`, `href="#note"`, `src="https://example.com/posts/chart.png"`} {
+		if !strings.Contains(html, want) {
+			t.Errorf("Expected HTML document to contain %q, got %q", want, html)
+		}
+	}
+
+	var b bytes.Buffer
+	if err := Digest(&b, "Digest", []rss.Post{post}); err != nil {
+		t.Fatalf("Digest failed: %v", err)
+	}
+	if !strings.Contains(b.String(), `href="https://example.com/about"`) {
+		t.Errorf("Expected the digest's links to be resolved, got %s", b.String())
+	}
+
+	if got := clean(post.Content, post.Link, true); !strings.Contains(got, `href="https://example.com/about"`) {
+		t.Errorf("Expected the book's links to be resolved, got %s", got)
+	}
+}
+
+func TestMarkdownFiles(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "out")
+	if _, err := Write(testPosts(), Markdown, dir, "izrss"); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("Failed to read export dir: %v", err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	want := "2026-01-02-a-quoted-post.md a-quoted-post.md"
+	if strings.Join(names, " ") != want {
+		t.Errorf("Expected files %q, got %q", want, names)
+	}
+
+	// A second export keeps the first's files
+	first, _ := os.ReadFile(filepath.Join(dir, "a-quoted-post.md"))
+	posts := testPosts()
+	posts[1].Content = "<p>Changed</p>"
+	if _, err := Write(posts, Markdown, dir, "izrss"); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if again, _ := os.ReadFile(filepath.Join(dir, "a-quoted-post.md")); !bytes.Equal(again, first) {
+		t.Errorf("Expected the earlier export to be kept, got %q", again)
+	}
+	if again, err := os.ReadFile(filepath.Join(dir, "a-quoted-post-2.md")); err != nil || !strings.Contains(string(again), "Changed") {
+		t.Errorf("Expected the new export beside the old one, got %q, %v", again, err)
+	}
+}
+
+func TestDigest(t *testing.T) {
+	var b bytes.Buffer
+	if err := Digest(&b, "My <digest>", testPosts()); err != nil {
+		t.Fatalf("Digest failed: %v", err)
+	}
+	out := b.String()
+
+	for _, want := range []string{"<title>My &lt;digest&gt;</title>", `<a href="#post-1">`, "Alpha · by Ada · 2026-01-02", `<img src="https://example.com/x.png"`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected digest to contain %q", want)
+		}
+	}
+	if strings.Contains(out, "<script>") || strings.Contains(out, "onclick") {
+		t.Errorf("Expected scripts and handlers to be stripped, got %s", out)
+	}
+}
+
+func TestBook(t *testing.T) {
+	var b bytes.Buffer
+	if err := Book(&b, "Digest & more", testPosts(), time.Date(2026, 1, 3, 0, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatalf("Book failed: %v", err)
+	}
+
+	z, err := zip.NewReader(bytes.NewReader(b.Bytes()), int64(b.Len()))
+	if err != nil {
+		t.Fatalf("Expected a zip archive: %v", err)
+	}
+
+	first := z.File[0]
+	if first.Name != "mimetype" || first.Method != zip.Store {
+		t.Errorf("Expected an uncompressed mimetype first, got %s (method %d)", first.Name, first.Method)
+	}
+
+	files := make(map[string]string)
+	for _, f := range z.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatalf("Failed to open %s: %v", f.Name, err)
+		}
+		data, _ := io.ReadAll(r)
+		_ = r.Close()
+		files[f.Name] = string(data)
+	}
+
+	if files["mimetype"] != "application/epub+zip" {
+		t.Errorf("Unexpected mimetype %q", files["mimetype"])
+	}
+	for _, name := range []string{"META-INF/container.xml", "OEBPS/content.opf", "OEBPS/nav.xhtml", "OEBPS/post-1.xhtml", "OEBPS/post-2.xhtml"} {
+		content, ok := files[name]
+		if !ok {
+			t.Errorf("Expected %s in the book", name)
+			continue
+		}
+		if err := wellFormed(content); err != nil {
+			t.Errorf("Expected %s to be well-formed XML: %v\n%s", name, err, content)
+		}
+	}
+
+	chapter := files["OEBPS/post-1.xhtml"]
+	if strings.Contains(chapter, "<img") || !strings.Contains(chapter, "[a chart]") {
+		t.Errorf("Expected remote images to be replaced by their alt text, got %s", chapter)
+	}
+	if !strings.Contains(files["OEBPS/content.opf"], "<dc:title>Digest &amp; more</dc:title>") {
+		t.Errorf("Expected the escaped title in the package, got %s", files["OEBPS/content.opf"])
+	}
+}
+
+func wellFormed(content string) error {
+	d := xml.NewDecoder(strings.NewReader(content))
+	for {
+		if _, err := d.Token(); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package export
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+
+	"github.com/isabelroses/izrss/internal/rss"
+)
+
+var digestTemplate = template.Must(template.New("digest").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { max-width: 40em; margin: 2em auto; padding: 0 1em; font-family: serif; line-height: 1.5; }
+img { max-width: 100%; height: auto; }
+.meta { color: #666; font-size: 0.9em; }
+article { border-top: 1px solid #ccc; margin-top: 2em; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<nav><ol>
+{{- range $i, $p := .Posts}}
+<li><a href="#post-{{$i}}">{{$p.Title}}</a></li>
+{{- end}}
+</ol></nav>
+{{- range $i, $p := .Posts}}
+<article id="post-{{$i}}">
+<h2>{{if $p.Link}}<a href="{{$p.Link}}">{{$p.Title}}</a>{{else}}{{$p.Title}}{{end}}</h2>
+<p class="meta">{{$p.Meta}}</p>
+{{$p.Content}}
+</article>
+{{- end}}
+</body>
+</html>
+`))
+
+type digestPost struct {
+	Title   string
+	Link    string
+	Meta    string
+	Content template.HTML
+}
+
+// Digest writes posts as a single HTML page, with a table of contents up top.
+func Digest(w io.Writer, title string, posts []rss.Post) error {
+	data := struct {
+		Title string
+		Posts []digestPost
+	}{Title: title}
+
+	for _, post := range posts {
+		data.Posts = append(data.Posts, digestPost{
+			Title: post.Title,
+			Link:  post.Link,
+			Meta:  byline(post),
+			// Scripts and the like are stripped, so what is left is safe to
+			// include as is.
+			Content: template.HTML(clean(post.Content, post.Link, false)),
+		})
+	}
+
+	if err := digestTemplate.Execute(w, data); err != nil {
+		return fmt.Errorf("writing html digest: %w", err)
+	}
+	return nil
+}
+
+// byline is the line of details shown under each post's title
+func byline(post rss.Post) string {
+	var parts []string
+	if post.FeedTitle != "" {
+		parts = append(parts, post.FeedTitle)
+	}
+	if len(post.Authors) > 0 {
+		parts = append(parts, "by "+strings.Join(post.Authors, ", "))
+	}
+	if !post.Published.IsZero() {
+		parts = append(parts, post.Published.Format(time.DateOnly))
+	}
+	return strings.Join(parts, " · ")
+}
+
+// dropped are elements that never belong in an exported post
+var dropped = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Iframe: true, atom.Object: true,
+	atom.Embed: true, atom.Form: true, atom.Noscript: true, atom.Link: true,
+	atom.Meta: true,
+}
+
+// clean strips scripts, embeds and event handlers from a post's HTML and
+// renders it again, which also closes every tag. Relative links are resolved
+// against the post's link. For EPUB, which may not load remote images, images
+// are replaced with their alt text.
+func clean(content, link string, noImages bool) string {
+	return rewriteHTML(content, func(body *html.Node) {
+		cleanNode(body, noImages)
+		resolveLinks(body, link)
+	})
+}
+
+// absolute resolves the relative links and images in a post's HTML against
+// its link, so they still work once exported away from the site.
+func absolute(content, link string) string {
+	return rewriteHTML(content, func(body *html.Node) {
+		resolveLinks(body, link)
+	})
+}
+
+// rewriteHTML parses a post's HTML, lets edit change it, and renders it again.
+// HTML that can't be parsed is escaped.
+func rewriteHTML(content string, edit func(body *html.Node)) string {
+	body := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, err := html.ParseFragment(strings.NewReader(content), body)
+	if err != nil {
+		return html.EscapeString(content)
+	}
+
+	var b strings.Builder
+	for _, n := range nodes {
+		body.AppendChild(n)
+	}
+	edit(body)
+	for n := body.FirstChild; n != nil; n = n.NextSibling {
+		if err := html.Render(&b, n); err != nil {
+			return html.EscapeString(content)
+		}
+	}
+	return b.String()
+}
+
+// resolveLinks resolves every href and src under n against link, as the
+// reader does. Links within the post, like "#note-1", are left alone.
+func resolveLinks(n *html.Node, link string) {
+	base, err := url.Parse(link)
+	if err != nil || !base.IsAbs() {
+		return
+	}
+
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode {
+			continue
+		}
+		for i, a := range c.Attr {
+			val := strings.TrimSpace(a.Val)
+			if a.Key != "href" && a.Key != "src" || val == "" || strings.HasPrefix(val, "#") {
+				continue
+			}
+			if ref, err := url.Parse(val); err == nil {
+				c.Attr[i].Val = base.ResolveReference(ref).String()
+			}
+		}
+		resolveLinks(c, link)
+	}
+}
+
+func cleanNode(n *html.Node, noImages bool) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+
+		switch {
+		case c.Type == html.CommentNode, c.Type == html.ElementNode && dropped[c.DataAtom]:
+			n.RemoveChild(c)
+		case c.Type == html.ElementNode && c.DataAtom == atom.Img && noImages:
+			alt := attr(c, "alt")
+			if alt == "" {
+				alt = "image"
+			}
+			n.InsertBefore(&html.Node{Type: html.TextNode, Data: "[" + alt + "]"}, c)
+			n.RemoveChild(c)
+		case c.Type == html.ElementNode:
+			keep := c.Attr[:0]
+			for _, a := range c.Attr {
+				if safeAttr(a) {
+					keep = append(keep, a)
+				}
+			}
+			c.Attr = keep
+			cleanNode(c, noImages)
+		}
+
+		c = next
+	}
+}
+
+// safeAttr reports whether an attribute can be kept: event handlers and
+// javascript: links are dropped, as are namespaced attributes, which are not
+// valid in XHTML without their declarations.
+func safeAttr(a html.Attribute) bool {
+	key := strings.ToLower(a.Key)
+	if a.Namespace != "" || strings.Contains(key, ":") || strings.HasPrefix(key, "on") {
+		return false
+	}
+	val := strings.ToLower(strings.TrimSpace(a.Val))
+	return !strings.HasPrefix(val, "javascript:")
+}
+
+func attr(n *html.Node, name string) string {
+	for _, a := range n.Attr {
+		if a.Key == name {
+			return a.Val
+		}
+	}
+	return ""
+}
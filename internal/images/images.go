@@ -0,0 +1,231 @@
+// Package images renders images for display in the terminal
+package images
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"strings"
+
+	// Register the decoders feeds commonly use with image.Decode
+	_ "image/gif"
+	_ "image/jpeg"
+)
+
+// Protocol is a way of drawing images in a terminal
+type Protocol string
+
+// The supported protocols, from best to most widely supported
+const (
+	Kitty     Protocol = "kitty"
+	Sixel     Protocol = "sixel"
+	HalfBlock Protocol = "halfblock"
+)
+
+// cellWidth and cellHeight are the assumed size of a terminal cell in pixels,
+// used to size images for protocols that draw real pixels. Most terminal fonts
+// are close to this 1:2 ratio.
+const (
+	cellWidth  = 10
+	cellHeight = 20
+)
+
+// kittyChunk is the largest payload the kitty protocol accepts per escape.
+const kittyChunk = 4096
+
+// Detect picks the best protocol the terminal is likely to support, judged by
+// the environment since querying the terminal would race bubbletea for stdin.
+func Detect() Protocol {
+	term := os.Getenv("TERM")
+	program := os.Getenv("TERM_PROGRAM")
+
+	switch {
+	case os.Getenv("KITTY_WINDOW_ID") != "", term == "xterm-kitty",
+		term == "xterm-ghostty", program == "ghostty", program == "WezTerm":
+		return Kitty
+	case strings.HasPrefix(term, "foot"), strings.Contains(term, "mlterm"),
+		strings.Contains(term, "sixel"), program == "iTerm.app":
+		return Sixel
+	default:
+		return HalfBlock
+	}
+}
+
+// ParseProtocol maps a config value to a protocol, detecting it for "auto" or
+// an empty value.
+func ParseProtocol(s string) (Protocol, error) {
+	switch p := Protocol(strings.ToLower(s)); p {
+	case "", "auto":
+		return Detect(), nil
+	case Kitty, Sixel, HalfBlock:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown image protocol %q", s)
+	}
+}
+
+// maxPixels stops an image that claims huge dimensions, in a few bytes, from
+// being decoded into gigabytes of memory.
+const maxPixels = 25_000_000
+
+// Decode decodes PNG, JPEG or GIF data
+func Decode(data []byte) (image.Image, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decoding image: %w", err)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width > maxPixels/cfg.Height {
+		return nil, fmt.Errorf("image is %dx%d, over the limit of %d pixels", cfg.Width, cfg.Height, maxPixels)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decoding image: %w", err)
+	}
+	return img, nil
+}
+
+// Render draws img using p in at most cols by rows terminal cells. The result
+// always spans exactly as many lines as the cells it covers, so it can be
+// placed among other text without shifting it. Kitty images are sent once
+// with KittyTransmit and drawn with KittyPlace instead.
+func Render(img image.Image, p Protocol, cols, rows int) string {
+	w, h := fit(img.Bounds(), cols, rows)
+	if w == 0 || h == 0 {
+		return ""
+	}
+
+	switch p {
+	case Sixel:
+		return sixel(resize(img, w*cellWidth, h*cellHeight)) + strings.Repeat("\n", h-1)
+	default:
+		return halfBlock(resize(img, w, h*2))
+	}
+}
+
+// fit returns the size in cells that shows an image as large as possible
+// within cols by rows, keeping its aspect ratio and never enlarging it.
+func fit(bounds image.Rectangle, cols, rows int) (int, int) {
+	pw, ph := bounds.Dx(), bounds.Dy()
+	if pw <= 0 || ph <= 0 || cols <= 0 || rows <= 0 {
+		return 0, 0
+	}
+
+	w := min(cols, (pw+cellWidth-1)/cellWidth)
+	h := max(1, ph*w*cellWidth/(pw*cellHeight))
+	if h > rows {
+		h = rows
+		w = max(1, pw*h*cellHeight/(ph*cellWidth))
+	}
+	return w, h
+}
+
+// KittyTransmit sends img to the terminal as PNG under id, without showing
+// it, so it can be placed any number of times without sending it again.
+func KittyTransmit(img image.Image, id uint32) string {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return ""
+	}
+	data := base64.StdEncoding.EncodeToString(buf.Bytes())
+
+	var b strings.Builder
+	for i := 0; i < len(data); i += kittyChunk {
+		end := min(i+kittyChunk, len(data))
+		more := 0
+		if end < len(data) {
+			more = 1
+		}
+
+		if i == 0 {
+			fmt.Fprintf(&b, "\x1b_Ga=t,f=100,q=2,i=%d,m=%d;%s\x1b\\", id, more, data[i:end])
+		} else {
+			fmt.Fprintf(&b, "\x1b_Gm=%d;%s\x1b\\", more, data[i:end])
+		}
+	}
+	return b.String()
+}
+
+// KittyPlace shows the image sent under id, which is img, scaled into at most
+// cols by rows cells. Placing it again with the same placement id moves it
+// rather than adding another.
+func KittyPlace(img image.Image, id, placement uint32, cols, rows int) string {
+	w, h := fit(img.Bounds(), cols, rows)
+	if w == 0 || h == 0 {
+		return ""
+	}
+	return fmt.Sprintf("\x1b_Ga=p,q=2,i=%d,p=%d,c=%d,r=%d\x1b\\", id, placement, w, h) +
+		strings.Repeat("\n", h-1)
+}
+
+// KittyClear removes every kitty image shown on screen, and with free drops
+// the images' data from the terminal too.
+func KittyClear(free bool) string {
+	if free {
+		return "\x1b_Ga=d,d=A,q=2\x1b\\"
+	}
+	return "\x1b_Ga=d,d=a,q=2\x1b\\"
+}
+
+// halfBlock draws two pixels per cell with an upper half block, the top pixel
+// as the foreground colour and the bottom as the background.
+func halfBlock(img *image.RGBA) string {
+	bounds := img.Bounds()
+
+	var b strings.Builder
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += 2 {
+		if y > bounds.Min.Y {
+			b.WriteByte('\n')
+		}
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			top := img.RGBAAt(x, y)
+			bottom := top
+			if y+1 < bounds.Max.Y {
+				bottom = img.RGBAAt(x, y+1)
+			}
+			fmt.Fprintf(&b, "\x1b[38;2;%d;%d;%dm\x1b[48;2;%d;%d;%dm▀",
+				top.R, top.G, top.B, bottom.R, bottom.G, bottom.B)
+		}
+		b.WriteString("\x1b[0m")
+	}
+
+	return b.String()
+}
+
+// resize scales img to w by h pixels, averaging the source pixels each target
+// pixel covers so downscaled text and line art stay legible.
+func resize(img image.Image, w, h int) *image.RGBA {
+	src := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+
+	for y := 0; y < h; y++ {
+		y0 := src.Min.Y + y*src.Dy()/h
+		y1 := max(y0+1, src.Min.Y+(y+1)*src.Dy()/h)
+		for x := 0; x < w; x++ {
+			x0 := src.Min.X + x*src.Dx()/w
+			x1 := max(x0+1, src.Min.X+(x+1)*src.Dx()/w)
+
+			var r, g, b, a, n uint32
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := img.At(sx, sy).RGBA()
+					r, g, b, a = r+pr, g+pg, b+pb, a+pa
+					n++
+				}
+			}
+
+			dst.SetRGBA(x, y, color.RGBA{
+				R: uint8(r / n >> 8),
+				G: uint8(g / n >> 8),
+				B: uint8(b / n >> 8),
+				A: uint8(a / n >> 8),
+			})
+		}
+	}
+
+	return dst
+}
@@ -0,0 +1,132 @@
+package images
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func solid(w, h int, c color.RGBA) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+func TestFit(t *testing.T) {
+	tests := []struct {
+		name       string
+		w, h       int
+		cols, rows int
+		wantW      int
+		wantH      int
+	}{
+		{name: "small images keep their size", w: 40, h: 40, cols: 80, rows: 40, wantW: 4, wantH: 2},
+		{name: "wide images shrink to the columns", w: 2000, h: 1000, cols: 80, rows: 40, wantW: 80, wantH: 20},
+		{name: "tall images shrink to the rows", w: 1000, h: 4000, cols: 80, rows: 20, wantW: 10, wantH: 20},
+		{name: "empty images are skipped", w: 0, h: 0, cols: 80, rows: 20, wantW: 0, wantH: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, h := fit(image.Rect(0, 0, tt.w, tt.h), tt.cols, tt.rows)
+			if w != tt.wantW || h != tt.wantH {
+				t.Errorf("expected %dx%d cells, got %dx%d", tt.wantW, tt.wantH, w, h)
+			}
+		})
+	}
+}
+
+func TestRender_HalfBlock(t *testing.T) {
+	img := solid(200, 200, color.RGBA{R: 255, A: 255})
+
+	out := Render(img, HalfBlock, 10, 10)
+
+	lines := strings.Split(out, "\n")
+	if len(lines) != 5 {
+		t.Fatalf("Expected 5 lines, got %d", len(lines))
+	}
+	if got := strings.Count(lines[0], "▀"); got != 10 {
+		t.Errorf("Expected 10 cells per line, got %d", got)
+	}
+	if !strings.Contains(lines[0], "\x1b[38;2;255;0;0m") {
+		t.Errorf("Expected a red foreground, got %q", lines[0])
+	}
+}
+
+func TestRender_Sixel(t *testing.T) {
+	img := solid(200, 200, color.RGBA{B: 255, A: 255})
+
+	out := Render(img, Sixel, 10, 10)
+
+	if !strings.HasPrefix(out, "\x1bP0;1;0q\"1;1;100;100") {
+		t.Errorf("Expected a sixel header sized 100x100, got %q", out[:min(len(out), 30)])
+	}
+	if !strings.Contains(out, "\x1b\\") {
+		t.Error("Expected the sixel string terminator")
+	}
+	if got := strings.Count(out, "\n"); got != 4 {
+		t.Errorf("Expected the image to reserve 5 lines, got %d", got+1)
+	}
+}
+
+func TestKitty(t *testing.T) {
+	img := solid(20, 20, color.RGBA{G: 255, A: 255})
+
+	if out := KittyTransmit(img, 7); !strings.HasPrefix(out, "\x1b_Ga=t,f=100,q=2,i=7,m=0;") {
+		t.Errorf("Unexpected kitty transmit header %q", out[:min(len(out), 40)])
+	}
+	if out := KittyPlace(img, 7, 3, 10, 10); out != "\x1b_Ga=p,q=2,i=7,p=3,c=2,r=1\x1b\\" {
+		t.Errorf("Unexpected kitty placement %q", out)
+	}
+	if out := KittyPlace(solid(20, 80, color.RGBA{A: 255}), 7, 3, 10, 10); strings.Count(out, "\n") != 3 {
+		t.Errorf("Expected the placement to reserve 4 lines, got %q", out)
+	}
+}
+
+func TestParseProtocol(t *testing.T) {
+	t.Setenv("TERM", "xterm-kitty")
+
+	p, err := ParseProtocol("auto")
+	if err != nil || p != Kitty {
+		t.Errorf("Expected kitty to be detected, got %q (%v)", p, err)
+	}
+
+	p, err = ParseProtocol("Sixel")
+	if err != nil || p != Sixel {
+		t.Errorf("Expected sixel, got %q (%v)", p, err)
+	}
+
+	if _, err := ParseProtocol("ascii"); err == nil {
+		t.Error("Expected an error for an unknown protocol")
+	}
+}
+
+func TestDecode_RejectsHugeImages(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, solid(2, 2, color.RGBA{R: 255, A: 255})); err != nil {
+		t.Fatalf("Failed to encode PNG: %v", err)
+	}
+	if _, err := Decode(buf.Bytes()); err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+
+	// Claim 100000x100000 pixels in the header, a few bytes that would
+	// decode to 40GB
+	data := buf.Bytes()
+	binary.BigEndian.PutUint32(data[16:], 100000)
+	binary.BigEndian.PutUint32(data[20:], 100000)
+	binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+
+	if _, err := Decode(data); err == nil || !strings.Contains(err.Error(), "over the limit") {
+		t.Errorf("Expected an image over the pixel limit to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,99 @@
+package images
+
+import (
+	"fmt"
+	"image"
+	"strings"
+)
+
+// sixel encodes img as a DEC sixel image using a fixed 6x6x6 colour cube,
+// which is cheap to map to and good enough for pictures in a reader.
+// Transparent pixels are left unpainted.
+func sixel(img *image.RGBA) string {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+
+	var b strings.Builder
+	// P2=1 keeps unpainted pixels transparent; the raster attributes give the
+	// size up front so terminals can allocate the image in one go.
+	fmt.Fprintf(&b, "\x1bP0;1;0q\"1;1;%d;%d", w, h)
+	for i := 0; i < 216; i++ {
+		r, g, bl := i/36, i/6%6, i%6
+		fmt.Fprintf(&b, "#%d;2;%d;%d;%d", i, r*20, g*20, bl*20)
+	}
+
+	index := make([]int, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := img.RGBAAt(bounds.Min.X+x, bounds.Min.Y+y)
+			if c.A < 128 {
+				index[y*w+x] = -1
+				continue
+			}
+			index[y*w+x] = int(level(c.R))*36 + int(level(c.G))*6 + int(level(c.B))
+		}
+	}
+
+	// Each sixel band covers six pixel rows; every colour in the band is drawn
+	// in its own pass over the row, returning to the start with "$".
+	for top := 0; top < h; top += 6 {
+		used := make(map[int]bool)
+		for y := top; y < min(top+6, h); y++ {
+			for x := 0; x < w; x++ {
+				if c := index[y*w+x]; c >= 0 {
+					used[c] = true
+				}
+			}
+		}
+
+		first := true
+		for c := 0; c < 216; c++ {
+			if !used[c] {
+				continue
+			}
+			if !first {
+				b.WriteByte('$')
+			}
+			first = false
+
+			fmt.Fprintf(&b, "#%d", c)
+			run, prev := 0, byte(0)
+			for x := 0; x < w; x++ {
+				var bits byte
+				for dy := 0; dy < 6 && top+dy < h; dy++ {
+					if index[(top+dy)*w+x] == c {
+						bits |= 1 << dy
+					}
+				}
+				ch := '?' + bits
+				if run > 0 && ch != prev {
+					writeRun(&b, prev, run)
+					run = 0
+				}
+				prev = ch
+				run++
+			}
+			writeRun(&b, prev, run)
+		}
+		b.WriteByte('-')
+	}
+
+	b.WriteString("\x1b\\")
+	return b.String()
+}
+
+// level maps an 8-bit channel to the nearest of the cube's six levels.
+func level(v uint8) uint8 {
+	return uint8((int(v)*5 + 127) / 255)
+}
+
+// writeRun writes ch n times, using sixel's "!n" repeat for longer runs.
+func writeRun(b *strings.Builder, ch byte, n int) {
+	if n > 3 {
+		fmt.Fprintf(b, "!%d%c", n, ch)
+		return
+	}
+	for i := 0; i < n; i++ {
+		b.WriteByte(ch)
+	}
+}
@@ -0,0 +1,228 @@
+// Package readability extracts the main article from a web page, dropping the
+// navigation, sidebars and other boilerplate around it
+package readability
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+)
+
+// ErrNoContent is returned when a page has nothing that looks like an article.
+var ErrNoContent = errors.New("no article content found")
+
+var (
+	// unlikely matches the class or id of page furniture, and likely those of
+	// content; an element matching both is kept.
+	unlikely = regexp.MustCompile(`(?i)banner|breadcrumb|combx|comment|community|cookie|disqus|extra|foot|header|menu|modal|nav|pager|popup|promo|related|remark|rss|share|shoutbox|sidebar|skyscraper|social|sponsor|subscribe|newsletter|tags|widget`)
+	likely   = regexp.MustCompile(`(?i)and|article|body|column|content|main|post|shadow|story|text`)
+
+	positive = regexp.MustCompile(`(?i)article|body|content|entry|hentry|main|page|post|story|text|blog`)
+	negative = regexp.MustCompile(`(?i)hidden|banner|combx|comment|com-|contact|foot|footer|footnote|masthead|media|meta|outbrain|promo|related|scroll|share|shoutbox|sidebar|skyscraper|sponsor|shopping|tags|tool|widget|ad-|advert`)
+)
+
+// minParagraph is the shortest text, in characters, that counts as prose.
+const minParagraph = 25
+
+// Extract returns the HTML of the main article in page, with relative links
+// and images resolved against pageURL.
+func Extract(page, pageURL string) (string, error) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(page))
+	if err != nil {
+		return "", fmt.Errorf("parsing page: %w", err)
+	}
+
+	prepare(doc)
+
+	top := topCandidate(doc)
+	if top == nil {
+		return "", ErrNoContent
+	}
+
+	article := collect(top)
+	clean(article)
+	resolve(article, pageURL)
+
+	out, err := article.Html()
+	if err != nil {
+		return "", fmt.Errorf("rendering article: %w", err)
+	}
+	if strings.TrimSpace(article.Text()) == "" {
+		return "", ErrNoContent
+	}
+	return out, nil
+}
+
+// prepare removes elements that are never part of an article, and those whose
+// class or id marks them as page furniture.
+func prepare(doc *goquery.Document) {
+	doc.Find("script, style, noscript, iframe, form, nav, aside, footer, header, button, svg, link, meta").Remove()
+
+	doc.Find("*").Each(func(_ int, s *goquery.Selection) {
+		if s.Is("html, body, article, main") {
+			return
+		}
+		match := s.AttrOr("class", "") + " " + s.AttrOr("id", "")
+		if unlikely.MatchString(match) && !likely.MatchString(match) {
+			s.Remove()
+		}
+	})
+}
+
+// topCandidate scores each paragraph's parent and grandparent by the prose it
+// holds, the way Arc90's readability does, and returns the best one.
+func topCandidate(doc *goquery.Document) *goquery.Selection {
+	scores := make(map[*html.Node]float64)
+	var order []*html.Node
+
+	addScore := func(s *goquery.Selection, score float64) {
+		if s.Length() == 0 {
+			return
+		}
+		node := s.Get(0)
+		if _, ok := scores[node]; !ok {
+			scores[node] = initialScore(s)
+			order = append(order, node)
+		}
+		scores[node] += score
+	}
+
+	doc.Find("p, pre, td, blockquote").Each(func(_ int, s *goquery.Selection) {
+		text := strings.TrimSpace(s.Text())
+		if len(text) < minParagraph {
+			return
+		}
+
+		score := 1 + float64(strings.Count(text, ",")) + math.Min(float64(len(text))/100, 3)
+		addScore(s.Parent(), score)
+		addScore(s.Parent().Parent(), score/2)
+	})
+
+	var (
+		best      *html.Node
+		bestScore float64
+	)
+	for _, node := range order {
+		score := scores[node] * (1 - linkDensity(goquery.NewDocumentFromNode(node).Selection))
+		if best == nil || score > bestScore {
+			best, bestScore = node, score
+		}
+	}
+
+	if best == nil {
+		return nil
+	}
+	return goquery.NewDocumentFromNode(best).Selection
+}
+
+func initialScore(s *goquery.Selection) float64 {
+	var score float64
+	switch goquery.NodeName(s) {
+	case "article", "main":
+		score = 10
+	case "div":
+		score = 5
+	case "pre", "td", "blockquote":
+		score = 3
+	case "address", "ol", "ul", "dl", "dd", "dt", "li", "form":
+		score = -3
+	case "h1", "h2", "h3", "h4", "h5", "h6", "th":
+		score = -5
+	}
+
+	for _, attr := range []string{s.AttrOr("class", ""), s.AttrOr("id", "")} {
+		if attr == "" {
+			continue
+		}
+		if positive.MatchString(attr) {
+			score += 25
+		}
+		if negative.MatchString(attr) {
+			score -= 25
+		}
+	}
+	return score
+}
+
+// linkDensity is the share of an element's text that sits inside links.
+func linkDensity(s *goquery.Selection) float64 {
+	total := len(strings.TrimSpace(s.Text()))
+	if total == 0 {
+		return 0
+	}
+
+	links := 0
+	s.Find("a").Each(func(_ int, a *goquery.Selection) {
+		links += len(strings.TrimSpace(a.Text()))
+	})
+	return float64(links) / float64(total)
+}
+
+// collect returns the top candidate along with any siblings that also read as
+// prose, since articles are often split across several containers.
+func collect(top *goquery.Selection) *goquery.Selection {
+	if top.Parent().Length() == 0 {
+		return top
+	}
+
+	article := goquery.NewDocumentFromNode(&html.Node{Type: html.ElementNode, Data: "div"}).Selection
+	top.Parent().Children().Each(func(_ int, s *goquery.Selection) {
+		if s.Get(0) == top.Get(0) {
+			article.AppendSelection(s.Clone())
+			return
+		}
+
+		text := strings.TrimSpace(s.Text())
+		if s.Is("p") && len(text) > 80 && linkDensity(s) < 0.25 {
+			article.AppendSelection(s.Clone())
+		}
+	})
+	return article
+}
+
+// clean drops what is left of the boilerplate inside the article: link-heavy
+// lists and blocks, and elements left empty.
+func clean(article *goquery.Selection) {
+	article.Find("ul, ol, div, table").Each(func(_ int, s *goquery.Selection) {
+		if s.Find("img, pre").Length() > 0 {
+			return
+		}
+		if linkDensity(s) > 0.5 {
+			s.Remove()
+		}
+	})
+
+	article.Find("p, div, span").Each(func(_ int, s *goquery.Selection) {
+		if strings.TrimSpace(s.Text()) == "" && s.Find("img").Length() == 0 {
+			s.Remove()
+		}
+	})
+}
+
+// resolve makes the article's links and images absolute, as it is shown away
+// from the page it came from.
+func resolve(article *goquery.Selection, pageURL string) {
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return
+	}
+
+	for _, attr := range []struct{ selector, name string }{
+		{"a[href]", "href"},
+		{"img[src]", "src"},
+	} {
+		article.Find(attr.selector).Each(func(_ int, s *goquery.Selection) {
+			ref, err := url.Parse(s.AttrOr(attr.name, ""))
+			if err != nil {
+				return
+			}
+			s.SetAttr(attr.name, base.ResolveReference(ref).String())
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package readability
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const page = `<!DOCTYPE html>
+<html><head><title>A post</title><script>track()</script></head>
+<body>
+<header><a href="/">Home</a> <a href="/about">About</a></header>
+<nav class="menu"><ul><li><a href="/a">Archive</a></li><li><a href="/b">Tags</a></li></ul></nav>
+<div class="layout">
+  <div class="sidebar"><p>Subscribe to the newsletter for more posts like this one, every week.</p></div>
+  <div class="post-content">
+    <h1>Why terminals, still</h1>
+    <p>Terminals have outlived every prediction of their demise, and for good reason: they are fast, scriptable, and composable.</p>
+    <p>Reading feeds in one keeps the focus on the words, without the trackers, pop-ups, and autoplaying video of the modern web.</p>
+    <p>See <a href="/related">a related post</a> and this chart, which shows how often that happens.</p>
+    <img src="/chart.png" alt="chart">
+    <ul class="share"><li><a href="https://social.example">Share</a></li></ul>
+  </div>
+</div>
+<footer><p>Copyright 2026, all rights reserved, no exceptions whatsoever.</p></footer>
+</body></html>`
+
+func TestExtract(t *testing.T) {
+	article, err := Extract(page, "https://blog.example/posts/terminals")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, want := range []string{
+		"Terminals have outlived every prediction",
+		"without the trackers",
+		`href="https://blog.example/related"`,
+		`src="https://blog.example/chart.png"`,
+	} {
+		if !strings.Contains(article, want) {
+			t.Errorf("Expected article to contain %q, got:\n%s", want, article)
+		}
+	}
+
+	for _, unwanted := range []string{"Archive", "newsletter", "Copyright", "track()", "Share"} {
+		if strings.Contains(article, unwanted) {
+			t.Errorf("Expected boilerplate %q to be removed, got:\n%s", unwanted, article)
+		}
+	}
+}
+
+func TestExtract_NoContent(t *testing.T) {
+	_, err := Extract(`<html><body><nav><a href="/">Home</a></nav></body></html>`, "https://blog.example/")
+	if !errors.Is(err, ErrNoContent) {
+		t.Errorf("Expected ErrNoContent, got %v", err)
+	}
+}
@@ -0,0 +1,93 @@
+package rss
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Credentials are sent with the requests for a feed
+type Credentials struct {
+	Username string
+	Password string
+	// Token is sent as a bearer token, taking the place of basic auth
+	Token   string
+	Headers map[string]string
+}
+
+// WithCredentials sets how the credentials for a feed are looked up. Each
+// feed's are looked up once, the first time it is fetched.
+func WithCredentials(lookup func(url string) (Credentials, error)) Option {
+	return func(f *Fetcher) error {
+		f.credentials = lookup
+		return nil
+	}
+}
+
+// authHeadersKey carries the names of the headers authorize set on a request,
+// so they can be taken off if it is redirected to another host
+type authHeadersKey struct{}
+
+// authorize adds the credentials for the feed at url to req, returning it
+// with the names of the headers it set.
+func (f *Fetcher) authorize(req *http.Request, url string) (*http.Request, error) {
+	if f.credentials == nil {
+		return req, nil
+	}
+
+	f.resolvedMu.Lock()
+	creds, ok := f.resolved[url]
+	f.resolvedMu.Unlock()
+
+	if !ok {
+		var err error
+		creds, err = f.credentials(url)
+		if err != nil {
+			// Not remembered, so a failing password command is tried again on
+			// the next refresh.
+			return nil, fmt.Errorf("looking up credentials: %w", err)
+		}
+		f.resolvedMu.Lock()
+		f.resolved[url] = creds
+		f.resolvedMu.Unlock()
+	}
+
+	names := make([]string, 0, len(creds.Headers)+1)
+	for name, value := range creds.Headers {
+		req.Header.Set(name, value)
+		names = append(names, name)
+	}
+	switch {
+	case creds.Token != "":
+		req.Header.Set("Authorization", "Bearer "+creds.Token)
+		names = append(names, "Authorization")
+	case creds.Username != "" || creds.Password != "":
+		req.SetBasicAuth(creds.Username, creds.Password)
+		names = append(names, "Authorization")
+	}
+	if len(names) == 0 {
+		return req, nil
+	}
+	return req.WithContext(context.WithValue(req.Context(), authHeadersKey{}, names)), nil
+}
+
+// maxRedirects is as many redirects as net/http follows by default
+const maxRedirects = 10
+
+// checkRedirect keeps a feed's credentials from following it to another host.
+// net/http only drops Authorization and cookies, and for subdomains keeps
+// them, so headers such as PRIVATE-TOKEN would otherwise be sent on.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+	names, ok := req.Context().Value(authHeadersKey{}).([]string)
+	if !ok || strings.EqualFold(req.URL.Host, via[0].URL.Host) {
+		return nil
+	}
+	for _, name := range names {
+		req.Header.Del(name)
+	}
+	return nil
+}
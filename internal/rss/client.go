@@ -0,0 +1,169 @@
+package rss
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// DefaultUserAgent is sent when no other user agent is configured. Some sites
+// turn away Go's own.
+const DefaultUserAgent = "izrss (+https://github.com/isabelroses/izrss)"
+
+// Network configures how a Fetcher talks to the network. Zero values keep the
+// defaults.
+type Network struct {
+	UserAgent string
+	// Proxy is an http, https or socks5 proxy URL; by default the proxy is
+	// taken from the environment
+	Proxy string
+	// FeedProxies overrides the proxy for the feeds at the given URLs. A
+	// proxy of "none" fetches the feed directly.
+	FeedProxies map[string]string
+	// ConnectTimeout bounds connecting to a server, including the TLS
+	// handshake
+	ConnectTimeout time.Duration
+	// ReadTimeout bounds a whole feed, image or article request. Downloads
+	// aren't bound by it, only by ConnectTimeout.
+	ReadTimeout time.Duration
+	// CABundle is a PEM file of certificates trusted along with the system's
+	CABundle string
+	// Insecure skips verifying servers' certificates
+	Insecure bool
+}
+
+const (
+	defaultConnectTimeout = 10 * time.Second
+	defaultReadTimeout    = 20 * time.Second
+)
+
+// WithNetwork configures the Fetcher's HTTP clients
+func WithNetwork(n Network) Option {
+	return func(f *Fetcher) error {
+		client, download, err := newClients(n)
+		if err != nil {
+			return err
+		}
+		f.client, f.downloadClient = client, download
+
+		f.feedProxies = make(map[string]*url.URL, len(n.FeedProxies))
+		for feed, proxy := range n.FeedProxies {
+			if proxy == "none" {
+				f.feedProxies[feed] = nil
+				continue
+			}
+			u, err := parseProxy(proxy)
+			if err != nil {
+				return fmt.Errorf("proxy for %s: %w", feed, err)
+			}
+			f.feedProxies[feed] = u
+		}
+		return nil
+	}
+}
+
+// proxyKey marks a request with the proxy of the feed it fetches
+type proxyKey struct{}
+
+// withFeedProxy routes req through the proxy configured for the feed at
+// feedURL, if it has one of its own.
+func (f *Fetcher) withFeedProxy(req *http.Request, feedURL string) *http.Request {
+	proxy, ok := f.feedProxies[feedURL]
+	if !ok {
+		return req
+	}
+	return req.WithContext(context.WithValue(req.Context(), proxyKey{}, proxy))
+}
+
+// newClients builds the client for feeds, images and articles, and the one
+// for downloads, which has no overall timeout since an episode can take far
+// longer than a feed.
+func newClients(n Network) (*http.Client, *http.Client, error) {
+	connectTimeout := n.ConnectTimeout
+	if connectTimeout <= 0 {
+		connectTimeout = defaultConnectTimeout
+	}
+	readTimeout := n.ReadTimeout
+	if readTimeout <= 0 {
+		readTimeout = defaultReadTimeout
+	}
+	userAgent := n.UserAgent
+	if userAgent == "" {
+		userAgent = DefaultUserAgent
+	}
+
+	proxy := http.ProxyFromEnvironment
+	if n.Proxy != "" {
+		u, err := parseProxy(n.Proxy)
+		if err != nil {
+			return nil, nil, err
+		}
+		proxy = http.ProxyURL(u)
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: n.Insecure}
+	if n.CABundle != "" {
+		pem, err := os.ReadFile(n.CABundle)
+		if err != nil {
+			return nil, nil, fmt.Errorf("reading CA bundle: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, nil, fmt.Errorf("no certificates found in CA bundle %s", n.CABundle)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.DialContext = (&net.Dialer{Timeout: connectTimeout, KeepAlive: 30 * time.Second}).DialContext
+	t.TLSHandshakeTimeout = connectTimeout
+	t.ResponseHeaderTimeout = readTimeout
+	t.TLSClientConfig = tlsConfig
+	t.Proxy = func(req *http.Request) (*url.URL, error) {
+		// A feed set to fetch directly carries a nil proxy
+		if u, ok := req.Context().Value(proxyKey{}).(*url.URL); ok {
+			return u, nil
+		}
+		return proxy(req)
+	}
+
+	rt := userAgentTransport{next: t, userAgent: userAgent}
+	client := &http.Client{Transport: rt, Timeout: readTimeout, CheckRedirect: checkRedirect}
+	return client, &http.Client{Transport: rt}, nil
+}
+
+func parseProxy(proxy string) (*url.URL, error) {
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("parsing proxy %q: %w", proxy, err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+		return u, nil
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q in %q", u.Scheme, proxy)
+	}
+}
+
+// userAgentTransport sets the User-Agent of requests that don't have one
+type userAgentTransport struct {
+	next      http.RoundTripper
+	userAgent string
+}
+
+func (t userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("User-Agent") == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("User-Agent", t.userAgent)
+	}
+	return t.next.RoundTrip(req)
+}
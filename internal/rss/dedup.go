@@ -0,0 +1,280 @@
+package rss
+
+import (
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// trackingParams are query parameters that only say where a link was shared,
+// so two links differing in them lead to the same article.
+var trackingParams = []string{"utm_", "fbclid", "gclid", "mc_cid", "mc_eid", "ref", "source"}
+
+// canonicalLink reduces a link to the article it leads to, so the same article
+// linked from different feeds compares equal.
+func canonicalLink(link string) string {
+	u, err := url.Parse(strings.TrimSpace(link))
+	if err != nil || u.Host == "" {
+		return ""
+	}
+
+	host := strings.TrimPrefix(strings.ToLower(u.Host), "www.")
+	query := u.Query()
+	for param := range query {
+		for _, tracking := range trackingParams {
+			if param == tracking || strings.HasSuffix(tracking, "_") && strings.HasPrefix(param, tracking) {
+				query.Del(param)
+			}
+		}
+	}
+
+	canonical := host + strings.TrimSuffix(u.EscapedPath(), "/")
+	if q := query.Encode(); q != "" {
+		canonical += "?" + q
+	}
+	// Fragments are kept, as a feed may link each post to its own part of
+	// one page
+	if u.Fragment != "" {
+		canonical += "#" + u.EscapedFragment()
+	}
+	return canonical
+}
+
+var nonWord = regexp.MustCompile(`[^\p{L}\p{N}]+`)
+
+// normalizeTitle reduces a title to its words, ignoring case and punctuation
+func normalizeTitle(title string) string {
+	return strings.TrimSpace(nonWord.ReplaceAllString(strings.ToLower(title), " "))
+}
+
+// globalGUID reports whether a GUID is unique beyond its feed: a URL, or a
+// urn: or tag: URI. Many feeds number their items "1", "2" and so on, which
+// would match unrelated posts.
+func globalGUID(guid string) bool {
+	lower := strings.ToLower(guid)
+	if strings.HasPrefix(lower, "urn:") || strings.HasPrefix(lower, "tag:") {
+		return true
+	}
+	u, err := url.Parse(guid)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// dedupKeys are the ways a post can be recognised in another feed: its link,
+// its GUID, and its title on the day it was published.
+func dedupKeys(post Post) []string {
+	var keys []string
+	if link := canonicalLink(post.Link); link != "" {
+		keys = append(keys, "link:"+link)
+	}
+	// Posts without a GUID are keyed by their link or a hash of their
+	// content, which are no use across feeds
+	if post.UUID != post.Link && globalGUID(post.UUID) {
+		keys = append(keys, "guid:"+post.UUID)
+	}
+	if title := normalizeTitle(post.Title); title != "" && !post.Published.IsZero() {
+		keys = append(keys, "title:"+post.Published.UTC().Format("2006-01-02")+":"+title)
+	}
+	return keys
+}
+
+// groupCopies groups n posts that are copies of one another, in order, where
+// feed and keys give each post's feed and dedup keys. Only posts from
+// different feeds are copies: posts in one feed sharing a link, like the
+// entries of a changelog page, are separate posts.
+func groupCopies(n int, feed func(int) int, keys func(int) []string) [][]int {
+	var (
+		groups     [][]int
+		groupFeeds []map[int]bool
+	)
+	groupOf := make(map[string][]int)
+	for i := range n {
+		group := -1
+	find:
+		for _, key := range keys(i) {
+			for _, g := range groupOf[key] {
+				if !groupFeeds[g][feed(i)] {
+					group = g
+					break find
+				}
+			}
+		}
+		if group < 0 {
+			group = len(groups)
+			groups = append(groups, nil)
+			groupFeeds = append(groupFeeds, make(map[int]bool))
+		}
+
+		groups[group] = append(groups[group], i)
+		groupFeeds[group][feed(i)] = true
+		for _, key := range keys(i) {
+			if !slices.Contains(groupOf[key], group) {
+				groupOf[key] = append(groupOf[key], group)
+			}
+		}
+	}
+	return groups
+}
+
+// GroupDuplicates groups posts that are copies of one another from different
+// feeds, going by their FeedID, and keeps the order the posts are given in.
+// Each group's first post stands for the rest.
+func GroupDuplicates(posts []Post) [][]Post {
+	keys := make([][]string, len(posts))
+	for i, post := range posts {
+		keys[i] = dedupKeys(post)
+	}
+
+	indices := groupCopies(len(posts),
+		func(i int) int { return posts[i].FeedID },
+		func(i int) []string { return keys[i] })
+
+	groups := make([][]Post, len(indices))
+	for g, group := range indices {
+		for _, i := range group {
+			groups[g] = append(groups[g], posts[i])
+		}
+	}
+	return groups
+}
+
+// postRef is a post's position in its Feeds
+type postRef struct{ feed, post int }
+
+// duplicateGroups groups every post in feeds with its copies in other feeds,
+// newest first like the mixed view, so both group posts alike.
+func (feeds Feeds) duplicateGroups() [][]postRef {
+	var (
+		refs []postRef
+		keys [][]string
+	)
+	for i, feed := range feeds {
+		for j := range feed.Posts {
+			refs = append(refs, postRef{i, j})
+		}
+	}
+	post := func(ref postRef) Post { return feeds[ref.feed].Posts[ref.post] }
+	slices.SortStableFunc(refs, func(a, b postRef) int {
+		return post(b).Published.Compare(post(a).Published)
+	})
+	for _, ref := range refs {
+		keys = append(keys, dedupKeys(post(ref)))
+	}
+
+	indices := groupCopies(len(refs),
+		func(i int) int { return refs[i].feed },
+		func(i int) []string { return keys[i] })
+
+	groups := make([][]postRef, len(indices))
+	for g, group := range indices {
+		for _, i := range group {
+			groups[g] = append(groups[g], refs[i])
+		}
+	}
+	return groups
+}
+
+// Copies records which posts in some Feeds are copies of one another.
+// Finding them compares every post, so it is done once as the feeds load and
+// kept until they change, rather than each time a post is marked.
+type Copies struct {
+	groups  [][]postRef
+	groupOf map[postRef]int
+}
+
+// FindCopies groups every post in feeds with its copies in other feeds
+func (feeds Feeds) FindCopies() *Copies {
+	c := &Copies{groups: feeds.duplicateGroups(), groupOf: make(map[postRef]int)}
+	for g, group := range c.groups {
+		for _, ref := range group {
+			c.groupOf[ref] = g
+		}
+	}
+	return c
+}
+
+// post returns the post at ref in feeds, if feeds still has one there
+func (feeds Feeds) post(ref postRef) (Post, bool) {
+	if ref.feed < 0 || ref.feed >= len(feeds) || ref.post < 0 || ref.post >= len(feeds[ref.feed].Posts) {
+		return Post{}, false
+	}
+	return feeds[ref.feed].Posts[ref.post], true
+}
+
+// Groups returns every post in feeds grouped with its copies, newest first
+// like the mixed view. Each group's first post is its newest copy, and stands
+// for the rest.
+func (c *Copies) Groups(feeds Feeds) [][]Post {
+	groups := make([][]Post, 0, len(c.groups))
+	for _, refs := range c.groups {
+		var group []Post
+		for _, ref := range refs {
+			if post, ok := feeds.post(ref); ok {
+				group = append(group, post)
+			}
+		}
+		if len(group) > 0 {
+			groups = append(groups, group)
+		}
+	}
+	return groups
+}
+
+// With returns posts from feeds along with their copies in other feeds
+func (c *Copies) With(feeds Feeds, posts []Post) []Post {
+	seen := make(map[postRef]bool, len(posts))
+	for _, post := range posts {
+		seen[postRef{post.FeedID, post.ID}] = true
+	}
+
+	out := slices.Clone(posts)
+	for _, post := range posts {
+		g, ok := c.groupOf[postRef{post.FeedID, post.ID}]
+		if !ok {
+			continue
+		}
+		for _, ref := range c.groups[g] {
+			if seen[ref] {
+				continue
+			}
+			seen[ref] = true
+			if dup, ok := feeds.post(ref); ok {
+				out = append(out, dup)
+			}
+		}
+	}
+	return out
+}
+
+// First keeps the first of posts from each group of copies, leaving out the
+// copies after it.
+func (c *Copies) First(posts []Post) []Post {
+	kept := make(map[int]bool)
+	out := make([]Post, 0, len(posts))
+	for _, post := range posts {
+		if g, ok := c.groupOf[postRef{post.FeedID, post.ID}]; ok {
+			if kept[g] {
+				continue
+			}
+			kept[g] = true
+		}
+		out = append(out, post)
+	}
+	return out
+}
+
+// shareReadState marks every copy of a read post as read, so an article read
+// in one feed isn't left unread in another.
+func (feeds Feeds) shareReadState() {
+	for _, group := range feeds.duplicateGroups() {
+		read := slices.ContainsFunc(group, func(ref postRef) bool {
+			return feeds[ref.feed].Posts[ref.post].Read
+		})
+		if !read {
+			continue
+		}
+		for _, ref := range group {
+			feeds[ref.feed].Posts[ref.post].Read = true
+		}
+	}
+}
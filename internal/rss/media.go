@@ -0,0 +1,158 @@
+package rss
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// IsMedia reports whether an enclosure is audio or video, as opposed to, say,
+// an attached PDF.
+func (e Enclosure) IsMedia() bool {
+	return strings.HasPrefix(e.Type, "audio/") || strings.HasPrefix(e.Type, "video/")
+}
+
+// FileName is the name an enclosure is saved under, taken from its URL.
+func (e Enclosure) FileName() string {
+	name := "enclosure"
+	if u, err := url.Parse(e.URL); err == nil {
+		if base := path.Base(u.Path); base != "." && base != "/" {
+			name = base
+		}
+	}
+	return name
+}
+
+// HasMedia reports whether a post has an audio or video enclosure
+func (p Post) HasMedia() bool {
+	for _, e := range p.Enclosures {
+		if e.IsMedia() {
+			return true
+		}
+	}
+	return false
+}
+
+// parseDuration reads an iTunes duration, given either in seconds or as
+// [HH:]MM:SS.
+func parseDuration(s string) time.Duration {
+	var total time.Duration
+	for _, part := range strings.Split(strings.TrimSpace(s), ":") {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return 0
+		}
+		total = total*60 + time.Duration(n)
+	}
+	return total * time.Second
+}
+
+// Download saves an enclosure into dir, reporting the bytes written so far and
+// the total, which is -1 when the server doesn't say. The file only takes its
+// final name once complete, so an interrupted download never looks finished.
+// A file already there is never replaced: feeds that call every episode
+// "audio.mp3" are saved as "audio (2).mp3" and so on.
+func (f *Fetcher) Download(ctx context.Context, e Enclosure, dir string, progress func(written, total int64)) (string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("creating download directory: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, e.URL, nil)
+	if err != nil {
+		return "", fmt.Errorf("downloading %s: %w", e.URL, err)
+	}
+	resp, err := f.downloadClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("downloading %s: %w", e.URL, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("downloading %s: %s", e.URL, resp.Status)
+	}
+
+	name := e.FileName()
+	file, err := os.CreateTemp(dir, name+".*.part")
+	if err != nil {
+		return "", fmt.Errorf("creating %s: %w", name, err)
+	}
+	part := file.Name()
+	// CreateTemp keeps the file to its owner, which a downloaded episode
+	// needn't be
+	if err := file.Chmod(0o644); err != nil {
+		_ = file.Close()
+		_ = os.Remove(part)
+		return "", fmt.Errorf("creating %s: %w", name, err)
+	}
+
+	w := &progressWriter{w: file, total: resp.ContentLength, progress: progress}
+	_, err = io.Copy(w, resp.Body)
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(part)
+		return "", fmt.Errorf("downloading %s: %w", e.URL, err)
+	}
+
+	dest, err := claimName(part, dir, name)
+	if err != nil {
+		_ = os.Remove(part)
+		return "", fmt.Errorf("saving %s: %w", name, err)
+	}
+	return dest, nil
+}
+
+// claimName moves the file at part to the first of name, "name (2)" and so
+// on that is free in dir, returning where it went.
+func claimName(part, dir, name string) (string, error) {
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	for n := 1; ; n++ {
+		dest := filepath.Join(dir, name)
+		if n > 1 {
+			dest = filepath.Join(dir, fmt.Sprintf("%s (%d)%s", stem, n, ext))
+		}
+
+		// A hard link fails if dest exists, so two downloads can't both take
+		// one name. Filesystems without hard links fall back to checking first.
+		err := os.Link(part, dest)
+		switch {
+		case err == nil:
+			return dest, os.Remove(part)
+		case errors.Is(err, fs.ErrExist):
+			continue
+		}
+
+		if _, err := os.Lstat(dest); err == nil {
+			continue
+		}
+		return dest, os.Rename(part, dest)
+	}
+}
+
+type progressWriter struct {
+	w        io.Writer
+	written  int64
+	total    int64
+	progress func(written, total int64)
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.written += int64(n)
+	if p.progress != nil {
+		p.progress(p.written, p.total)
+	}
+	return n, err
+}
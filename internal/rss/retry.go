@@ -0,0 +1,188 @@
+package rss
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Retry configures how failed requests are retried. Network errors, server
+// errors and 429s are retried after an exponential backoff with jitter, or
+// after the server's Retry-After if it sends one.
+type Retry struct {
+	// Attempts is how many times a request is retried after failing
+	Attempts int
+	// BaseDelay is the most the first retry waits, doubling for each after
+	BaseDelay time.Duration
+	// MaxDelay caps any one wait, including a Retry-After
+	MaxDelay time.Duration
+}
+
+// HostLimit bounds the load a refresh puts on any one host, for when many
+// feeds are followed from the same site.
+type HostLimit struct {
+	// Concurrency is how many of a host's feeds are fetched at once
+	Concurrency int
+	// Interval is the least time between starting fetches from a host
+	Interval time.Duration
+}
+
+var (
+	defaultRetry     = Retry{Attempts: 2, BaseDelay: time.Second, MaxDelay: 30 * time.Second}
+	defaultHostLimit = HostLimit{Concurrency: 2}
+)
+
+// WithRetry sets how failed requests are retried
+func WithRetry(r Retry) Option {
+	return func(f *Fetcher) error {
+		f.retry = r
+		return nil
+	}
+}
+
+// WithHostLimit sets the per-host limit on refreshes
+func WithHostLimit(l HostLimit) Option {
+	return func(f *Fetcher) error {
+		if l.Concurrency <= 0 {
+			l.Concurrency = defaultHostLimit.Concurrency
+		}
+		f.hosts = newHostLimiter(l)
+		return nil
+	}
+}
+
+// do sends a GET request, retrying it as configured. Any response it returns
+// has a successful status.
+func (f *Fetcher) do(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := f.client.Do(req)
+		if err == nil && resp.StatusCode < 300 {
+			return resp, nil
+		}
+
+		var retryAfter time.Duration
+		if err == nil {
+			err = fmt.Errorf("server responded %s", resp.Status)
+			retryable := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+			retryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			_ = resp.Body.Close()
+			if !retryable {
+				return nil, err
+			}
+		}
+		if attempt >= f.retry.Attempts || req.Context().Err() != nil {
+			return nil, err
+		}
+
+		delay := f.retry.backoff(attempt)
+		if retryAfter > 0 {
+			delay = min(retryAfter, f.retry.MaxDelay)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, err
+		}
+	}
+}
+
+// backoff is how long to wait before retrying after the given attempt: a
+// random delay up to BaseDelay doubled for each attempt so far, so many feeds
+// failing at once don't all retry together.
+func (r Retry) backoff(attempt int) time.Duration {
+	ceiling := r.BaseDelay << attempt
+	if ceiling <= 0 || ceiling > r.MaxDelay {
+		ceiling = r.MaxDelay
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return rand.N(ceiling) + 1
+}
+
+// parseRetryAfter reads a Retry-After header, which is either a number of
+// seconds or a date, as a delay from now.
+func parseRetryAfter(header string, now time.Time) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(header); err == nil {
+		return max(time.Duration(secs)*time.Second, 0)
+	}
+	if t, err := http.ParseTime(header); err == nil {
+		return max(t.Sub(now), 0)
+	}
+	return 0
+}
+
+// hostLimiter hands out per-host slots for fetching feeds
+type hostLimiter struct {
+	limit HostLimit
+	mu    sync.Mutex
+	hosts map[string]*hostSlots
+}
+
+type hostSlots struct {
+	sem  chan struct{}
+	next time.Time
+}
+
+func newHostLimiter(l HostLimit) *hostLimiter {
+	return &hostLimiter{limit: l, hosts: make(map[string]*hostSlots)}
+}
+
+// acquire waits for a slot to fetch feedURL from its host, returning the
+// function that gives it back, or ctx's error if it is done first.
+func (l *hostLimiter) acquire(ctx context.Context, feedURL string) (func(), error) {
+	host := feedURL
+	if u, err := url.Parse(feedURL); err == nil && u.Host != "" {
+		host = u.Host
+	}
+
+	l.mu.Lock()
+	slots, ok := l.hosts[host]
+	if !ok {
+		slots = &hostSlots{sem: make(chan struct{}, l.limit.Concurrency)}
+		l.hosts[host] = slots
+	}
+	l.mu.Unlock()
+
+	select {
+	case slots.sem <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	release := func() { <-slots.sem }
+
+	if l.limit.Interval > 0 {
+		l.mu.Lock()
+		now := time.Now()
+		start := now
+		if slots.next.After(now) {
+			start = slots.next
+		}
+		slots.next = start.Add(l.limit.Interval)
+		l.mu.Unlock()
+
+		timer := time.NewTimer(start.Sub(now))
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			release()
+			return nil, ctx.Err()
+		}
+	}
+
+	return release, nil
+}
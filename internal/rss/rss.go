@@ -3,36 +3,59 @@ package rss
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/mmcdole/gofeed"
 
+	"github.com/isabelroses/izrss/internal/readability"
 	"github.com/isabelroses/izrss/internal/storage"
 )
 
-// httpClient's timeout stops one hung feed from stalling a whole refresh.
-var httpClient = &http.Client{Timeout: 20 * time.Second}
-
 // maxConcurrentFetches bounds peak memory: each in-flight feed holds its full
 // body and parsed object graph, so a large feed list would otherwise spike.
 const maxConcurrentFetches = 12
 
 // Post represents a single post in a feed
 type Post struct {
-	Published time.Time
-	UUID      string
-	Title     string
-	Content   string
-	Link      string
-	Date      string
-	ID        int
-	Read      bool
+	Published   time.Time
+	Updated     time.Time
+	Authors     []string
+	Categories  []string
+	Enclosures  []Enclosure
+	Image       string
+	Description string
+	UUID        string
+	Title       string
+	Content     string
+	Link        string
+	Date        string
+	FeedTitle   string
+	ID          int
+	FeedID      int
+	Read        bool
+	Starred     bool
+}
+
+// Enclosure is a file attached to a post, such as a podcast episode
+type Enclosure struct {
+	URL    string
+	Type   string
+	Length int64
+	// Duration is the running time the feed gives for the episode, if any
+	Duration time.Duration
 }
 
 // Feed represents a single feed
@@ -86,6 +109,19 @@ func (f Feeds) sort(urls []string) Feeds {
 	return f
 }
 
+// Reindex stamps every feed and post with its position, so a post copied into a
+// combined view (mixed, search) can still be traced back to its source feed.
+func (f Feeds) Reindex() {
+	for i := range f {
+		f[i].ID = i
+		for j := range f[i].Posts {
+			f[i].Posts[j].ID = j
+			f[i].Posts[j].FeedID = i
+			f[i].Posts[j].FeedTitle = f[i].Title
+		}
+	}
+}
+
 // ToggleRead toggles the read status of a post
 func ToggleRead(feeds Feeds, feedID, postID int) {
 	feeds[feedID].Posts[postID].Read = !feeds[feedID].Posts[postID].Read
@@ -103,6 +139,30 @@ func MarkRead(feeds Feeds, feedID, postID int) {
 	feeds[feedID].Posts[postID].Read = true
 }
 
+// SetRead sets the read status of a post
+func SetRead(feeds Feeds, feedID, postID int, read bool) {
+	feeds[feedID].Posts[postID].Read = read
+}
+
+// SetStarred stars or unstars a post
+func SetStarred(feeds Feeds, feedID, postID int, starred bool) {
+	feeds[feedID].Posts[postID].Starred = starred
+}
+
+// PostsOlderThan returns every post in all feeds published before cutoff. Posts
+// without a parseable date are left out, as their age is unknown.
+func (feeds Feeds) PostsOlderThan(cutoff time.Time) []Post {
+	var posts []Post
+	for _, feed := range feeds {
+		for _, post := range feed.Posts {
+			if !post.Published.IsZero() && post.Published.Before(cutoff) {
+				posts = append(posts, post)
+			}
+		}
+	}
+	return posts
+}
+
 // WriteTracking saves the tracking state to the database
 func (feeds Feeds) WriteTracking(db *storage.DB) error {
 	total := 0
@@ -123,20 +183,61 @@ func (feeds Feeds) WriteTracking(db *storage.DB) error {
 	return db.SavePostReadStatuses(statuses)
 }
 
-// ReadTracking reads the tracking state from the database
+// WritePosts saves the read state of only the given posts, looked up in feeds
+// by their FeedID and ID so the stored state matches what the UI shows.
+func (feeds Feeds) WritePosts(db *storage.DB, posts []Post) error {
+	changes := storage.NewChangeSet()
+	for _, post := range posts {
+		if post.FeedID >= len(feeds) || post.ID >= len(feeds[post.FeedID].Posts) {
+			continue
+		}
+		feed := feeds[post.FeedID]
+		changes.Set(feed.Posts[post.ID].UUID, feed.URL, feed.Posts[post.ID].Read)
+	}
+	return db.ApplyChangeSet(changes)
+}
+
+// WriteStars saves whether each of posts is starred, looked up in feeds like
+// WritePosts
+func (feeds Feeds) WriteStars(db *storage.DB, posts []Post) error {
+	for _, post := range posts {
+		if post.FeedID >= len(feeds) || post.ID >= len(feeds[post.FeedID].Posts) {
+			continue
+		}
+		feed := feeds[post.FeedID]
+		p := feed.Posts[post.ID]
+		if err := db.SavePostStarred(p.UUID, feed.URL, p.Starred); err != nil {
+			return fmt.Errorf("saving star for %s: %w", p.UUID, err)
+		}
+	}
+	return nil
+}
+
+// ReadTracking reads the tracking state from the database. A post read in
+// one feed is read in every feed it was also posted to.
 func (feeds *Feeds) ReadTracking(db *storage.DB) error {
 	statuses, err := db.LoadPostReadStatuses()
 	if err != nil {
 		return err
 	}
+	stars, err := db.LoadPostStars()
+	if err != nil {
+		return err
+	}
 
 	for i := range *feeds {
+		feedURL := (*feeds)[i].URL
 		for j := range (*feeds)[i].Posts {
-			if readStatus, exists := statuses[(*feeds)[i].Posts[j].UUID]; exists {
+			key := storage.PostKey{FeedURL: feedURL, UUID: (*feeds)[i].Posts[j].UUID}
+			if readStatus, exists := statuses[key]; exists {
 				(*feeds)[i].Posts[j].Read = readStatus
 			}
+			if starred, exists := stars[key]; exists {
+				(*feeds)[i].Posts[j].Starred = starred
+			}
 		}
 	}
+	feeds.shareReadState()
 
 	return nil
 }
@@ -145,52 +246,169 @@ func (feeds *Feeds) ReadTracking(db *storage.DB) error {
 type Fetcher struct {
 	db         *storage.DB
 	dateFormat string
+
+	// client's timeout stops one hung feed from stalling a whole refresh
+	client         *http.Client
+	downloadClient *http.Client
+	// rules run over the posts of every feed, and feedRules over those of
+	// the feed at each URL
+	rules     []Rule
+	feedRules map[string][]Rule
+
+	// sources fetch feeds by the scheme of their URLs
+	sources map[string]Source
+	// feedProxies holds the feeds with a proxy of their own
+	feedProxies map[string]*url.URL
+	retry       Retry
+	hosts       *hostLimiter
+
+	credentials func(url string) (Credentials, error)
+	// resolved holds the credentials looked up for each feed, so a password
+	// command runs once rather than on every refresh
+	resolved   map[string]Credentials
+	resolvedMu sync.Mutex
 }
 
+// Option configures a Fetcher
+type Option func(*Fetcher) error
+
 // NewFetcher creates a new Fetcher
-func NewFetcher(db *storage.DB, dateFormat string) *Fetcher {
-	return &Fetcher{
+func NewFetcher(db *storage.DB, dateFormat string, opts ...Option) (*Fetcher, error) {
+	f := &Fetcher{
 		db:         db,
 		dateFormat: dateFormat,
+		resolved:   make(map[string]Credentials),
+		retry:      defaultRetry,
+		hosts:      newHostLimiter(defaultHostLimit),
 	}
+	f.sources = f.defaultSources()
+	if err := WithNetwork(Network{})(f); err != nil {
+		return nil, err
+	}
+	for _, opt := range opts {
+		if err := opt(f); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
 }
 
 // FetchURL fetches the content of a URL and returns it as a byte slice
-func (f *Fetcher) FetchURL(url string, preferCache bool) ([]byte, error) {
+func (f *Fetcher) FetchURL(ctx context.Context, url string, preferCache bool) ([]byte, error) {
+	data, _, err := f.fetchFeed(ctx, url, preferCache)
+	return data, err
+}
+
+// fetchFeed is FetchURL, also returning the header the feed came with, which
+// is nil when it came from the cache.
+func (f *Fetcher) fetchFeed(ctx context.Context, url string, preferCache bool) ([]byte, http.Header, error) {
 	if preferCache {
 		if data, err := f.db.LoadFeedCache(url); err == nil && data != nil {
-			return data, nil
+			return data, nil, nil
 		}
 	}
 
-	resp, err := httpClient.Get(url)
+	source, err := f.source(url)
 	if err != nil {
-		return nil, fmt.Errorf("fetching URL %s: %w", url, err)
+		return nil, nil, fmt.Errorf("fetching URL %s: %w", url, err)
 	}
-	defer func() { _ = resp.Body.Close() }()
-
-	body, err := io.ReadAll(resp.Body)
+	body, header, err := source.Fetch(ctx, url)
 	if err != nil {
-		return nil, fmt.Errorf("reading response body: %w", err)
+		return nil, nil, fmt.Errorf("fetching URL %s: %w", url, err)
+	}
+	if header == nil {
+		header = http.Header{}
 	}
 
 	if err := f.db.SaveFeedCache(url, body); err != nil {
 		log.Printf("could not cache feed %s: %v", url, err)
 	}
 
+	return body, header, nil
+}
+
+// maxImageSize stops a huge image from being read into memory and the cache.
+const maxImageSize = 10 << 20
+
+// FetchImage returns an image's data, from the cache if it was fetched before.
+// Images rarely change at a URL, so the cache is never refreshed.
+func (f *Fetcher) FetchImage(ctx context.Context, url string) ([]byte, error) {
+	if data, err := f.db.LoadImageCache(url); err == nil && data != nil {
+		return data, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("fetching image %s: %w", url, err)
+	}
+	resp, err := f.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching image %s: %w", url, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxImageSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("reading image body: %w", err)
+	}
+	if len(body) > maxImageSize {
+		return nil, fmt.Errorf("image %s is larger than %d bytes", url, maxImageSize)
+	}
+
+	if err := f.db.SaveImageCache(url, body); err != nil {
+		log.Printf("could not cache image %s: %v", url, err)
+	}
+
 	return body, nil
 }
 
+// maxArticleSize stops a huge page from being read into memory to extract an
+// article from.
+const maxArticleSize = 5 << 20
+
+// FetchArticle returns the main article from a post's page, for feeds that
+// only ship a summary. Extracted articles are cached by link.
+func (f *Fetcher) FetchArticle(ctx context.Context, link string) (string, error) {
+	if content, err := f.db.LoadArticleCache(link); err == nil && content != "" {
+		return content, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return "", fmt.Errorf("fetching article %s: %w", link, err)
+	}
+	resp, err := f.do(req)
+	if err != nil {
+		return "", fmt.Errorf("fetching article %s: %w", link, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	page, err := io.ReadAll(io.LimitReader(resp.Body, maxArticleSize+1))
+	if err != nil {
+		return "", fmt.Errorf("reading article body: %w", err)
+	}
+	if len(page) > maxArticleSize {
+		return "", fmt.Errorf("article %s is larger than %d bytes", link, maxArticleSize)
+	}
+
+	content, err := readability.Extract(string(page), resp.Request.URL.String())
+	if err != nil {
+		return "", fmt.Errorf("extracting article %s: %w", link, err)
+	}
+
+	if err := f.db.SaveArticleCache(link, content); err != nil {
+		log.Printf("could not cache article %s: %v", link, err)
+	}
+
+	return content, nil
+}
+
 // GetContentForURL fetches the content of a URL and returns it as a Feed
-func (f *Fetcher) GetContentForURL(url string, preferCache bool) Feed {
-	feed := f.setupReader(url, preferCache)
+func (f *Fetcher) GetContentForURL(ctx context.Context, url string, preferCache bool) Feed {
+	feed := f.setupReader(ctx, url, preferCache)
 
 	if feed == nil {
-		return Feed{
-			Title: fmt.Sprintf("Error loading %s", url),
-			URL:   url,
-			Posts: []Post{},
-		}
+		return errorFeed(url)
 	}
 
 	feedRet := Feed{
@@ -202,14 +420,24 @@ func (f *Fetcher) GetContentForURL(url string, preferCache bool) Feed {
 	for _, item := range feed.Items {
 		feedRet.Posts = append(feedRet.Posts, f.createPost(item))
 	}
+	feedRet.Posts = f.applyRules(url, feedRet.Posts)
 
 	SortPosts(feedRet.Posts)
 	return feedRet
 }
 
+// errorFeed stands in for a feed that couldn't be loaded
+func errorFeed(url string) Feed {
+	return Feed{
+		Title: fmt.Sprintf("Error loading %s", url),
+		URL:   url,
+		Posts: []Post{},
+	}
+}
+
 // GetPosts fetches the content of a URL and returns it as a slice of Posts
-func (f *Fetcher) GetPosts(url string) []Post {
-	feed := f.setupReader(url, false)
+func (f *Fetcher) GetPosts(ctx context.Context, url string) []Post {
+	feed := f.setupReader(ctx, url, false)
 	if feed == nil {
 		return []Post{}
 	}
@@ -218,6 +446,7 @@ func (f *Fetcher) GetPosts(url string) []Post {
 	for _, item := range feed.Items {
 		posts = append(posts, f.createPost(item))
 	}
+	posts = f.applyRules(url, posts)
 
 	SortPosts(posts)
 	return posts
@@ -229,23 +458,99 @@ func (f *Fetcher) createPost(item *gofeed.Item) Post {
 		content = item.Description
 	}
 	if content == "" {
-		content = "This post does not contain any content.\nPress \"o\" to open the post in your preferred browser"
+		content = "This post does not contain any content.\nPress \"o\" to open the post in your preferred browser, or \"f\" to load the full article"
 	}
 
 	published, date := parseDate(item, f.dateFormat)
 
+	var updated time.Time
+	if item.UpdatedParsed != nil {
+		updated = *item.UpdatedParsed
+	}
+
 	return Post{
-		Title:     item.Title,
-		Content:   content,
-		Link:      item.Link,
-		Date:      date,
-		Published: published,
-		UUID:      item.GUID,
+		Title:       item.Title,
+		Content:     content,
+		Link:        item.Link,
+		Date:        date,
+		Published:   published,
+		Updated:     updated,
+		Authors:     authorNames(item),
+		Categories:  item.Categories,
+		Enclosures:  enclosures(item),
+		Image:       postImage(item),
+		Description: item.Description,
+		UUID:        postUUID(item),
+	}
+}
+
+// enclosures lists the files attached to an item, such as podcast episodes.
+func enclosures(item *gofeed.Item) []Enclosure {
+	var duration time.Duration
+	if item.ITunesExt != nil {
+		duration = parseDuration(item.ITunesExt.Duration)
+	}
+
+	out := make([]Enclosure, 0, len(item.Enclosures))
+	for _, e := range item.Enclosures {
+		if e == nil || e.URL == "" {
+			continue
+		}
+		length, _ := strconv.ParseInt(strings.TrimSpace(e.Length), 10, 64)
+		out = append(out, Enclosure{URL: e.URL, Type: e.Type, Length: length, Duration: duration})
 	}
+	return out
 }
 
-func (f *Fetcher) setupReader(url string, preferCache bool) *gofeed.Feed {
-	data, err := f.FetchURL(url, preferCache)
+// postImage is the URL of an item's image, taken from the item itself or its
+// iTunes artwork.
+func postImage(item *gofeed.Item) string {
+	if item.Image != nil && item.Image.URL != "" {
+		return item.Image.URL
+	}
+	if item.ITunesExt != nil {
+		return item.ITunesExt.Image
+	}
+	return ""
+}
+
+// authorNames lists an item's authors by name, or by email for those without
+// one.
+func authorNames(item *gofeed.Item) []string {
+	people := item.Authors
+	if len(people) == 0 && item.Author != nil {
+		people = []*gofeed.Person{item.Author}
+	}
+
+	names := make([]string, 0, len(people))
+	for _, person := range people {
+		switch {
+		case person == nil:
+		case person.Name != "":
+			names = append(names, person.Name)
+		case person.Email != "":
+			names = append(names, person.Email)
+		}
+	}
+	return names
+}
+
+// postUUID identifies an item within its feed. Many feeds omit the GUID, so it
+// falls back to the link, then to a hash of the title, date and content.
+func postUUID(item *gofeed.Item) string {
+	if item.GUID != "" {
+		return item.GUID
+	}
+	if item.Link != "" {
+		return item.Link
+	}
+
+	sum := sha256.Sum256([]byte(item.Title + "\x00" + item.Published + "\x00" + item.Content + item.Description))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func (f *Fetcher) setupReader(ctx context.Context, url string, preferCache bool) *gofeed.Feed {
+	data, header, err := f.fetchFeed(ctx, url, preferCache)
 	if err != nil {
 		log.Printf("could not fetch feed %s: %v", url, err)
 		return nil
@@ -261,28 +566,56 @@ func (f *Fetcher) setupReader(url string, preferCache bool) *gofeed.Feed {
 		return nil
 	}
 
-	return feed
-}
-
-// GetAllContent fetches the content of all URLs and returns it as Feeds
-func (f *Fetcher) GetAllContent(urls []string, preferCache bool) Feeds {
-	if !preferCache {
-		if err := f.db.SetCacheTime(); err != nil {
-			log.Printf("could not write cache time: %v", err)
+	if header != nil {
+		if err := f.schedule(url, feed, data, header, time.Now()); err != nil {
+			log.Printf("could not schedule feed %s: %v", url, err)
 		}
 	}
 
-	var wg sync.WaitGroup
+	return feed
+}
+
+// GetAllContent fetches the content of all URLs and returns it as Feeds.
+// refresh says which are fetched from the network, the rest coming from the
+// cache where they can. Once ctx is done, the feeds not yet fetched are left
+// as errors.
+func (f *Fetcher) GetAllContent(ctx context.Context, urls []string, refresh Refresh) Feeds {
+	var (
+		wg sync.WaitGroup
+		// fetched is set once any feed is fetched rather than read from cache,
+		// so a refresh with nothing due doesn't count as one
+		fetched atomic.Bool
+	)
 	responses := make(chan Feed, len(urls))
 
+	now := time.Now()
 	sem := make(chan struct{}, maxConcurrentFetches)
 	for _, url := range urls {
 		wg.Add(1)
 		go func(u string) {
 			defer wg.Done()
-			sem <- struct{}{}
+			preferCache := refresh == PreferCache || refresh == RefreshDue && !f.due(u, now)
+			// The host's slot is taken first, so feeds queued behind a busy
+			// host don't hold up the others.
+			if !preferCache {
+				release, err := f.hosts.acquire(ctx, u)
+				if err != nil {
+					responses <- errorFeed(u)
+					return
+				}
+				defer release()
+			}
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				responses <- errorFeed(u)
+				return
+			}
 			defer func() { <-sem }()
-			responses <- f.GetContentForURL(u, preferCache)
+			if !preferCache {
+				fetched.Store(true)
+			}
+			responses <- f.GetContentForURL(ctx, u, preferCache)
 		}(url)
 	}
 
@@ -296,7 +629,15 @@ func (f *Fetcher) GetAllContent(urls []string, preferCache bool) Feeds {
 		feeds = append(feeds, response)
 	}
 
-	return feeds.sort(urls)
+	if fetched.Load() {
+		if err := f.db.SetCacheTime(); err != nil {
+			log.Printf("could not write cache time: %v", err)
+		}
+	}
+
+	feeds = feeds.sort(urls)
+	feeds.Reindex()
+	return feeds
 }
 
 // Helper functions
@@ -1,10 +1,24 @@
 package rss
 
 import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/mmcdole/gofeed"
+
+	"github.com/isabelroses/izrss/internal/storage"
 )
 
 func TestGetTotalUnreads(t *testing.T) {
@@ -61,6 +75,26 @@ func TestToggleRead(t *testing.T) {
 	}
 }
 
+func TestReindex(t *testing.T) {
+	feeds := Feeds{
+		{Title: "first", Posts: []Post{{UUID: "1"}}},
+		{Title: "second", Posts: []Post{{UUID: "2"}, {UUID: "3"}}},
+	}
+
+	feeds.Reindex()
+
+	post := feeds[1].Posts[1]
+	if post.FeedID != 1 || post.ID != 1 {
+		t.Errorf("Expected post at feed 1, index 1, got feed %d, index %d", post.FeedID, post.ID)
+	}
+	if post.FeedTitle != "second" {
+		t.Errorf("Expected feed title 'second', got %q", post.FeedTitle)
+	}
+	if feeds[1].ID != 1 {
+		t.Errorf("Expected feed ID 1, got %d", feeds[1].ID)
+	}
+}
+
 func TestReadAll(t *testing.T) {
 	feeds := Feeds{
 		{Posts: []Post{
@@ -92,6 +126,24 @@ func TestMarkRead(t *testing.T) {
 	}
 }
 
+func TestSetRead(t *testing.T) {
+	feeds := Feeds{
+		{Posts: []Post{
+			{UUID: "1", Read: true},
+		}},
+	}
+
+	SetRead(feeds, 0, 0, false)
+	if feeds[0].Posts[0].Read {
+		t.Errorf("Expected post to be marked as unread")
+	}
+
+	SetRead(feeds, 0, 0, true)
+	if !feeds[0].Posts[0].Read {
+		t.Errorf("Expected post to be marked as read")
+	}
+}
+
 func TestReadSymbol(t *testing.T) {
 	if ReadSymbol(true) != "" {
 		t.Errorf("Expected empty string for read post")
@@ -119,6 +171,29 @@ func TestSortPosts(t *testing.T) {
 	}
 }
 
+func TestPostsOlderThan(t *testing.T) {
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	feeds := Feeds{
+		{Posts: []Post{
+			{UUID: "old", Published: base},
+			{UUID: "new", Published: base.Add(72 * time.Hour)},
+		}},
+		{Posts: []Post{
+			{UUID: "older", Published: base.Add(-24 * time.Hour)},
+			{UUID: "undated"},
+		}},
+	}
+
+	posts := feeds.PostsOlderThan(base.Add(24 * time.Hour))
+
+	if len(posts) != 2 {
+		t.Fatalf("Expected 2 posts, got %d", len(posts))
+	}
+	if posts[0].UUID != "old" || posts[1].UUID != "older" {
+		t.Errorf("Unexpected posts: %q, %q", posts[0].UUID, posts[1].UUID)
+	}
+}
+
 func TestParseDate(t *testing.T) {
 	parsed := time.Date(2026, 6, 29, 12, 0, 0, 0, time.UTC)
 
@@ -158,3 +233,1053 @@ func TestParseDate(t *testing.T) {
 		})
 	}
 }
+
+func TestPostUUID(t *testing.T) {
+	tests := []struct {
+		name string
+		item *gofeed.Item
+		want string
+	}{
+		{
+			name: "uses the GUID",
+			item: &gofeed.Item{GUID: "guid-1", Link: "http://example.com/1"},
+			want: "guid-1",
+		},
+		{
+			name: "falls back to the link",
+			item: &gofeed.Item{Link: "http://example.com/1"},
+			want: "http://example.com/1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := postUUID(tt.item); got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+
+	t.Run("hashes items with neither", func(t *testing.T) {
+		a := &gofeed.Item{Title: "a", Published: "2026-01-01"}
+		b := &gofeed.Item{Title: "b", Published: "2026-01-01"}
+
+		if postUUID(a) == "" || postUUID(a) == postUUID(b) {
+			t.Errorf("expected distinct non-empty hashes, got %q and %q", postUUID(a), postUUID(b))
+		}
+		if postUUID(a) != postUUID(&gofeed.Item{Title: "a", Published: "2026-01-01"}) {
+			t.Error("expected the hash to be stable")
+		}
+	})
+}
+
+// noGUIDFeed is a feed whose items carry no GUID, and one no link either.
+const noGUIDFeed = `<?xml version="1.0"?>
+<rss version="2.0"><channel><title>No GUIDs</title>
+<item><title>First</title><link>http://example.com/first</link></item>
+<item><title>Second</title><link>http://example.com/second</link></item>
+<item><title>Third</title><description>linkless</description></item>
+</channel></rss>`
+
+func TestReadTracking_FeedsWithoutGUIDs(t *testing.T) {
+	db := setupTestDB(t)
+
+	parsed, err := gofeed.NewParser().ParseString(noGUIDFeed)
+	if err != nil {
+		t.Fatalf("Failed to parse feed: %v", err)
+	}
+
+	f := &Fetcher{dateFormat: "2006-01-02"}
+	load := func(url string) Feeds {
+		feed := Feed{URL: url}
+		for _, item := range parsed.Items {
+			feed.Posts = append(feed.Posts, f.createPost(item))
+		}
+		feeds := Feeds{feed}
+		feeds.Reindex()
+		return feeds
+	}
+
+	feeds := load("http://example.com/feed")
+	MarkRead(feeds, 0, 0)
+	if err := feeds.WritePosts(db, feeds[0].Posts[:1]); err != nil {
+		t.Fatalf("Failed to write posts: %v", err)
+	}
+
+	reloaded := load("http://example.com/feed")
+	if err := reloaded.ReadTracking(db); err != nil {
+		t.Fatalf("Failed to read tracking: %v", err)
+	}
+	if !reloaded[0].Posts[0].Read {
+		t.Error("Expected the first post to stay read")
+	}
+	if reloaded[0].Posts[1].Read || reloaded[0].Posts[2].Read {
+		t.Error("Expected the other GUID-less posts to be unaffected")
+	}
+
+	other := load("http://example.org/feed")
+	if err := other.ReadTracking(db); err != nil {
+		t.Fatalf("Failed to read tracking: %v", err)
+	}
+	if other[0].Posts[0].Read {
+		t.Error("Expected the same post in another feed to be unaffected")
+	}
+}
+
+func setupTestDB(t testing.TB) *storage.DB {
+	t.Helper()
+
+	db, err := storage.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	return db
+}
+
+func TestWritePosts(t *testing.T) {
+	db := setupTestDB(t)
+
+	feeds := Feeds{
+		{URL: "http://example.com/feed", Posts: []Post{
+			{UUID: "1", Read: true},
+			{UUID: "2", Read: true},
+		}},
+	}
+	feeds.Reindex()
+
+	if err := feeds.WritePosts(db, feeds[0].Posts[:1]); err != nil {
+		t.Fatalf("Failed to write posts: %v", err)
+	}
+
+	statuses, err := db.LoadPostReadStatuses()
+	if err != nil {
+		t.Fatalf("Failed to load statuses: %v", err)
+	}
+	if !statuses[storage.PostKey{FeedURL: "http://example.com/feed", UUID: "1"}] {
+		t.Error("Expected post 1 to be saved as read")
+	}
+	if _, ok := statuses[storage.PostKey{FeedURL: "http://example.com/feed", UUID: "2"}]; ok {
+		t.Error("Expected post 2 to not be written")
+	}
+}
+
+func benchFeeds() Feeds {
+	feeds := make(Feeds, 30)
+	for i := range feeds {
+		feeds[i].URL = fmt.Sprintf("http://example.com/feed%d", i)
+		feeds[i].Posts = make([]Post, 150)
+		for j := range feeds[i].Posts {
+			feeds[i].Posts[j].UUID = fmt.Sprintf("%d-%d", i, j)
+		}
+	}
+	feeds.Reindex()
+	return feeds
+}
+
+func BenchmarkWriteTracking(b *testing.B) {
+	db := setupTestDB(b)
+	feeds := benchFeeds()
+	if err := feeds.WriteTracking(db); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ToggleRead(feeds, 0, 0)
+		if err := feeds.WriteTracking(db); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkWritePosts(b *testing.B) {
+	db := setupTestDB(b)
+	feeds := benchFeeds()
+	if err := feeds.WriteTracking(db); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ToggleRead(feeds, 0, 0)
+		if err := feeds.WritePosts(db, feeds[0].Posts[:1]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+const metadataFeed = `<?xml version="1.0"?>
+<feed xmlns="http://www.w3.org/2005/Atom"><title>Atom</title>
+<entry><title>Post</title><id>urn:post</id>
+<published>2026-01-02T10:00:00Z</published><updated>2026-01-03T10:00:00Z</updated>
+<author><name>Ada</name></author><author><email>bob@example.com</email></author>
+<category term="go"/><category term="terminal"/>
+</entry></feed>`
+
+func TestCreatePost_Metadata(t *testing.T) {
+	parsed, err := gofeed.NewParser().ParseString(metadataFeed)
+	if err != nil {
+		t.Fatalf("Failed to parse feed: %v", err)
+	}
+
+	f := &Fetcher{dateFormat: "2006-01-02"}
+	post := f.createPost(parsed.Items[0])
+
+	if got := strings.Join(post.Authors, ","); got != "Ada,bob@example.com" {
+		t.Errorf("Expected authors by name or email, got %q", got)
+	}
+	if got := strings.Join(post.Categories, ","); got != "go,terminal" {
+		t.Errorf("Expected categories, got %q", got)
+	}
+	if want := time.Date(2026, 1, 3, 10, 0, 0, 0, time.UTC); !post.Updated.Equal(want) {
+		t.Errorf("Expected updated %v, got %v", want, post.Updated)
+	}
+}
+
+const podcastFeed = `<?xml version="1.0"?>
+<rss version="2.0" xmlns:itunes="http://www.itunes.com/dtds/podcast-1.0.dtd"><channel><title>Podcast</title>
+<item><title>Episode 1</title><guid>ep1</guid>
+<description>Show notes</description>
+<itunes:image href="https://example.com/ep1.jpg"/>
+<enclosure url="https://example.com/ep1.mp3" type="audio/mpeg" length="1234"/>
+</item></channel></rss>`
+
+func TestGetContentForURL_KeepsMetadataInCache(t *testing.T) {
+	db := setupTestDB(t)
+	const url = "https://example.com/podcast.xml"
+	if err := db.SaveFeedCache(url, []byte(podcastFeed)); err != nil {
+		t.Fatalf("Failed to save feed cache: %v", err)
+	}
+
+	// Posts are rebuilt from the cached feed, so everything taken from an item
+	// survives a restart.
+	feed := newFetcher(t, db).GetContentForURL(t.Context(), url, true)
+	if len(feed.Posts) != 1 {
+		t.Fatalf("Expected one post, got %d", len(feed.Posts))
+	}
+
+	post := feed.Posts[0]
+	want := []Enclosure{{URL: "https://example.com/ep1.mp3", Type: "audio/mpeg", Length: 1234}}
+	if len(post.Enclosures) != 1 || post.Enclosures[0] != want[0] {
+		t.Errorf("Expected enclosures %v, got %v", want, post.Enclosures)
+	}
+	if post.Image != "https://example.com/ep1.jpg" {
+		t.Errorf("Expected the iTunes image, got %q", post.Image)
+	}
+	if post.Description != "Show notes" {
+		t.Errorf("Expected the description, got %q", post.Description)
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := map[string]time.Duration{
+		"90":       90 * time.Second,
+		"42:10":    42*time.Minute + 10*time.Second,
+		"1:02:03":  time.Hour + 2*time.Minute + 3*time.Second,
+		"":         0,
+		"about 1h": 0,
+	}
+	for in, want := range tests {
+		if got := parseDuration(in); got != want {
+			t.Errorf("parseDuration(%q) = %v, want %v", in, got, want)
+		}
+	}
+}
+
+func TestDownload(t *testing.T) {
+	body := strings.Repeat("x", 4096)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		_, _ = io.WriteString(w, body)
+	}))
+	defer srv.Close()
+
+	dir := filepath.Join(t.TempDir(), "episodes")
+	var written, total int64
+	path, err := newFetcher(t, nil).Download(t.Context(), Enclosure{URL: srv.URL + "/ep1.mp3"}, dir, func(w, tot int64) {
+		written, total = w, tot
+	})
+	if err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+
+	if path != filepath.Join(dir, "ep1.mp3") {
+		t.Errorf("Expected the file to be named after the URL, got %s", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != body {
+		t.Errorf("Expected the downloaded body, got %d bytes (%v)", len(data), err)
+	}
+	if written != int64(len(body)) || total != int64(len(body)) {
+		t.Errorf("Expected progress to reach %d of %d, got %d of %d", len(body), len(body), written, total)
+	}
+	if parts, _ := filepath.Glob(filepath.Join(dir, "*.part")); len(parts) != 0 {
+		t.Errorf("Expected the partial file to be renamed, got %v", parts)
+	}
+
+	// Another episode under the same name is saved beside the first
+	again, err := newFetcher(t, nil).Download(t.Context(), Enclosure{URL: srv.URL + "/other/ep1.mp3"}, dir, nil)
+	if err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+	if again != filepath.Join(dir, "ep1 (2).mp3") {
+		t.Errorf("Expected a numbered name, got %s", again)
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != body {
+		t.Errorf("Expected the first download to be kept, got %d bytes (%v)", len(data), err)
+	}
+}
+
+func TestFetchURL_Credentials(t *testing.T) {
+	var got http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		_, _ = io.WriteString(w, noGUIDFeed)
+	}))
+	defer srv.Close()
+
+	lookups := 0
+	f := newFetcher(t, setupTestDB(t), WithCredentials(func(url string) (Credentials, error) {
+		lookups++
+		if url == srv.URL+"/token" {
+			return Credentials{Token: "secret", Headers: map[string]string{"X-Extra": "1"}}, nil
+		}
+		return Credentials{Username: "me", Password: "hunter2"}, nil
+	}))
+
+	if _, err := f.FetchURL(t.Context(), srv.URL+"/basic", false); err != nil {
+		t.Fatalf("FetchURL failed: %v", err)
+	}
+	if user, pass, ok := (&http.Request{Header: got}).BasicAuth(); !ok || user != "me" || pass != "hunter2" {
+		t.Errorf("Expected basic auth, got %q", got.Get("Authorization"))
+	}
+
+	if _, err := f.FetchURL(t.Context(), srv.URL+"/token", false); err != nil {
+		t.Fatalf("FetchURL failed: %v", err)
+	}
+	if got.Get("Authorization") != "Bearer secret" || got.Get("X-Extra") != "1" {
+		t.Errorf("Expected a bearer token and extra header, got %v", got)
+	}
+
+	if _, err := f.FetchURL(t.Context(), srv.URL+"/token", false); err != nil {
+		t.Fatalf("FetchURL failed: %v", err)
+	}
+	if lookups != 2 {
+		t.Errorf("Expected credentials to be looked up once per feed, got %d lookups", lookups)
+	}
+}
+
+func TestFetchURL_CredentialsNotRedirected(t *testing.T) {
+	var got http.Header
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		_, _ = io.WriteString(w, noGUIDFeed)
+	}))
+	defer other.Close()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, other.URL+"/feed", http.StatusFound)
+	}))
+	defer srv.Close()
+
+	f := newFetcher(t, setupTestDB(t), WithCredentials(func(string) (Credentials, error) {
+		return Credentials{Token: "secret", Headers: map[string]string{"Private-Token": "secret"}}, nil
+	}))
+	if _, err := f.FetchURL(t.Context(), srv.URL+"/feed", false); err != nil {
+		t.Fatalf("FetchURL failed: %v", err)
+	}
+	if got.Get("Private-Token") != "" || got.Get("Authorization") != "" {
+		t.Errorf("Expected the credentials to stay with the feed's host, got %v", got)
+	}
+}
+
+func newFetcher(t *testing.T, db *storage.DB, opts ...Option) *Fetcher {
+	t.Helper()
+	f, err := NewFetcher(db, "2006-01-02", opts...)
+	if err != nil {
+		t.Fatalf("NewFetcher failed: %v", err)
+	}
+	return f
+}
+
+func TestFetchURL_Network(t *testing.T) {
+	var userAgent string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent = r.UserAgent()
+		_, _ = io.WriteString(w, noGUIDFeed)
+	}))
+	defer srv.Close()
+
+	// The proxy sees requests for feeds routed through it, and answers them
+	// in the origin's place.
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = append(proxied, r.URL.String())
+		_, _ = io.WriteString(w, noGUIDFeed)
+	}))
+	defer proxy.Close()
+
+	f := newFetcher(t, setupTestDB(t), WithNetwork(Network{
+		UserAgent:   "test-agent",
+		FeedProxies: map[string]string{srv.URL + "/proxied": proxy.URL},
+	}))
+
+	if _, err := f.FetchURL(t.Context(), srv.URL+"/direct", false); err != nil {
+		t.Fatalf("FetchURL failed: %v", err)
+	}
+	if userAgent != "test-agent" {
+		t.Errorf("Expected the configured user agent, got %q", userAgent)
+	}
+
+	if _, err := f.FetchURL(t.Context(), srv.URL+"/proxied", false); err != nil {
+		t.Fatalf("FetchURL failed: %v", err)
+	}
+	if len(proxied) != 1 || proxied[0] != srv.URL+"/proxied" {
+		t.Errorf("Expected only the proxied feed to go through the proxy, got %v", proxied)
+	}
+
+	if _, err := NewFetcher(nil, "", WithNetwork(Network{Proxy: "ftp://example.com"})); err == nil {
+		t.Error("Expected an unsupported proxy scheme to be an error")
+	}
+	if _, err := NewFetcher(nil, "", WithNetwork(Network{CABundle: "/nonexistent.pem"})); err == nil {
+		t.Error("Expected a missing CA bundle to be an error")
+	}
+}
+
+func TestFetchArticle_TooLarge(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "<html><body><article><p>")
+		_, _ = io.WriteString(w, strings.Repeat("a", maxArticleSize))
+		_, _ = io.WriteString(w, "</p></article></body></html>")
+	}))
+	defer srv.Close()
+
+	f := newFetcher(t, setupTestDB(t))
+	if _, err := f.FetchArticle(t.Context(), srv.URL+"/post"); err == nil || !strings.Contains(err.Error(), "larger than") {
+		t.Errorf("Expected a page over the size limit to be an error, got %v", err)
+	}
+}
+
+func TestFetchURL_Retries(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch {
+		case r.URL.Path == "/missing":
+			http.NotFound(w, r)
+		case r.URL.Path == "/down":
+			http.Error(w, "down", http.StatusBadGateway)
+		case requests == 1:
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "slow down", http.StatusTooManyRequests)
+		default:
+			_, _ = io.WriteString(w, noGUIDFeed)
+		}
+	}))
+	defer srv.Close()
+
+	db := setupTestDB(t)
+	f := newFetcher(t, db, WithRetry(Retry{Attempts: 2, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond}))
+
+	if _, err := f.FetchURL(t.Context(), srv.URL+"/limited", false); err != nil {
+		t.Fatalf("Expected the rate limited fetch to be retried, got %v", err)
+	}
+	if requests != 2 {
+		t.Errorf("Expected 2 requests, got %d", requests)
+	}
+
+	requests = 0
+	if _, err := f.FetchURL(t.Context(), srv.URL+"/down", false); err == nil {
+		t.Error("Expected a server error once retries ran out")
+	}
+	if requests != 3 {
+		t.Errorf("Expected a first try and 2 retries, got %d requests", requests)
+	}
+
+	requests = 0
+	if _, err := f.FetchURL(t.Context(), srv.URL+"/missing", false); err == nil {
+		t.Error("Expected a 404 to be an error")
+	}
+	if requests != 1 {
+		t.Errorf("Expected a 404 not to be retried, got %d requests", requests)
+	}
+	if data, _ := db.LoadFeedCache(srv.URL + "/missing"); data != nil {
+		t.Error("Expected an error page not to be cached")
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := map[string]time.Duration{
+		"":                              0,
+		"120":                           2 * time.Minute,
+		"-5":                            0,
+		"Mon, 01 Jan 2024 12:00:30 GMT": 30 * time.Second,
+		"Mon, 01 Jan 2024 11:00:00 GMT": 0,
+		"soon":                          0,
+	}
+	for header, want := range tests {
+		if got := parseRetryAfter(header, now); got != want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", header, got, want)
+		}
+	}
+}
+
+func TestGetAllContent_HostLimit(t *testing.T) {
+	var mu sync.Mutex
+	var inFlight, most int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		most = max(most, inFlight)
+		mu.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+		_, _ = io.WriteString(w, noGUIDFeed)
+
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	urls := make([]string, 8)
+	for i := range urls {
+		urls[i] = srv.URL + "/feed" + strconv.Itoa(i)
+	}
+
+	f := newFetcher(t, setupTestDB(t), WithHostLimit(HostLimit{Concurrency: 2}))
+	feeds := f.GetAllContent(t.Context(), urls, RefreshAll)
+	if len(feeds) != len(urls) {
+		t.Fatalf("Expected %d feeds, got %d", len(urls), len(feeds))
+	}
+	if most > 2 {
+		t.Errorf("Expected at most 2 fetches from the host at once, got %d", most)
+	}
+}
+
+func TestNextInterval(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	feed := &gofeed.Feed{}
+	var hourly []time.Time
+	for i := range 5 {
+		hourly = append(hourly, now.Add(-time.Duration(i)*4*time.Hour))
+	}
+
+	tests := []struct {
+		name    string
+		history []time.Time
+		data    string
+		header  http.Header
+		want    time.Duration
+	}{
+		{"cadence", hourly, "", nil, 2 * time.Hour},
+		{"no dates", nil, "", nil, maxInterval / 2},
+		{"ttl", hourly, "<rss><channel><ttl>300</ttl><item><ttl>1</ttl></item></channel></rss>", nil, 5 * time.Hour},
+		{"ttl after items", hourly, "<rss><channel><item></item><ttl>300</ttl></channel></rss>", nil, 2 * time.Hour},
+		{"max-age", hourly, "", http.Header{"Cache-Control": {"public, max-age=21600"}}, 6 * time.Hour},
+		{"expires", hourly, "", http.Header{"Expires": {"Mon, 01 Jan 2024 15:00:00 GMT"}}, 3 * time.Hour},
+		{"short hint", hourly, "", http.Header{"Cache-Control": {"max-age=60"}}, 2 * time.Hour},
+		{"long hint", hourly, "", http.Header{"Cache-Control": {"max-age=31536000"}}, maxHint},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := nextInterval(feed, tt.history, []byte(tt.data), tt.header, now); got != tt.want {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestSchedule_LearnsCadenceFromHistory(t *testing.T) {
+	db := setupTestDB(t)
+	f := newFetcher(t, db)
+	url := "https://example.com/feed"
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	// A feed that only ever carries its latest post
+	latest := func(uuid string, published time.Time) *gofeed.Feed {
+		return &gofeed.Feed{Items: []*gofeed.Item{{GUID: uuid, PublishedParsed: &published}}}
+	}
+
+	if err := f.schedule(url, latest("a", now.Add(-2*time.Hour)), nil, http.Header{}, now); err != nil {
+		t.Fatalf("schedule failed: %v", err)
+	}
+	if next, _ := db.LoadFeedSchedule(url); !next.Equal(now.Add(maxInterval / 2)) {
+		t.Errorf("Expected the default interval with one post seen, got %v", next.Sub(now))
+	}
+
+	if err := f.schedule(url, latest("b", now), nil, http.Header{}, now); err != nil {
+		t.Fatalf("schedule failed: %v", err)
+	}
+	if next, _ := db.LoadFeedSchedule(url); !next.Equal(now.Add(time.Hour)) {
+		t.Errorf("Expected the cadence of the posts seen so far, got %v", next.Sub(now))
+	}
+}
+
+func TestUpdatePeriod(t *testing.T) {
+	feed, err := gofeed.NewParser().ParseString(`<?xml version="1.0"?>
+<rss version="2.0" xmlns:sy="http://purl.org/rss/1.0/modules/syndication/">
+<channel>
+<title>Test</title>
+<sy:updatePeriod>daily</sy:updatePeriod>
+<sy:updateFrequency>4</sy:updateFrequency>
+</channel>
+</rss>`)
+	if err != nil {
+		t.Fatalf("Failed to parse feed: %v", err)
+	}
+	if got := updatePeriod(feed); got != 6*time.Hour {
+		t.Errorf("Expected a daily period updated 4 times to be 6h, got %v", got)
+	}
+}
+
+func TestGetAllContent_SkipsFeedsNotDue(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Cache-Control", "max-age=3600")
+		_, _ = io.WriteString(w, noGUIDFeed)
+	}))
+	defer srv.Close()
+
+	db := setupTestDB(t)
+	f := newFetcher(t, db)
+	urls := []string{srv.URL + "/feed"}
+
+	f.GetAllContent(t.Context(), urls, RefreshDue)
+	refreshed, err := db.GetCacheTime()
+	if err != nil || refreshed == nil {
+		t.Fatalf("Expected the refresh time to be set, got %v (%v)", refreshed, err)
+	}
+	// Cache times are stored to the second
+	time.Sleep(1100 * time.Millisecond)
+
+	feeds := f.GetAllContent(t.Context(), urls, RefreshDue)
+	if requests != 1 {
+		t.Errorf("Expected a feed that isn't due to be skipped, got %d requests", requests)
+	}
+	if again, _ := db.GetCacheTime(); again == nil || !again.Equal(*refreshed) {
+		t.Errorf("Expected a refresh with nothing due to keep the refresh time, got %v", again)
+	}
+	if len(feeds) != 1 || len(feeds[0].Posts) == 0 {
+		t.Errorf("Expected a skipped feed to come from the cache, got %+v", feeds)
+	}
+
+	f.GetAllContent(t.Context(), urls, RefreshAll)
+	if requests != 2 {
+		t.Errorf("Expected a forced refresh to fetch every feed, got %d requests", requests)
+	}
+}
+
+// waitForGoroutines fails the test unless the number of goroutines falls back
+// to at most want, giving them time to exit.
+func waitForGoroutines(t *testing.T, want int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > want {
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<16)
+			t.Fatalf("Expected at most %d goroutines, got %d:\n%s", want, runtime.NumGoroutine(), buf[:runtime.Stack(buf, true)])
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestGetAllContent_Cancel(t *testing.T) {
+	// The server never answers, so every fetch hangs until it is cancelled.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	f := newFetcher(t, setupTestDB(t))
+	before := runtime.NumGoroutine()
+
+	urls := make([]string, 20)
+	for i := range urls {
+		urls[i] = srv.URL + "/feed" + strconv.Itoa(i)
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	done := make(chan Feeds)
+	go func() { done <- f.GetAllContent(ctx, urls, RefreshAll) }()
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	select {
+	case feeds := <-done:
+		if len(feeds) != len(urls) {
+			t.Errorf("Expected a feed for each URL, got %d", len(feeds))
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected GetAllContent to return once cancelled")
+	}
+
+	f.client.CloseIdleConnections()
+	waitForGoroutines(t, before)
+}
+
+func TestSources(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "feed.xml")
+	if err := os.WriteFile(path, []byte(noGUIDFeed), 0o644); err != nil {
+		t.Fatalf("Failed to write feed: %v", err)
+	}
+
+	f := newFetcher(t, setupTestDB(t))
+	for _, url := range []string{
+		"file://" + path,
+		"exec:cat " + path,
+	} {
+		feed := f.GetContentForURL(t.Context(), url, false)
+		if len(feed.Posts) == 0 {
+			t.Errorf("Expected posts from %s, got %+v", url, feed)
+		}
+	}
+
+	if _, err := f.FetchURL(t.Context(), "gopher://example.com/feed", false); err == nil {
+		t.Error("Expected an unsupported scheme to be an error")
+	}
+	if _, err := f.FetchURL(t.Context(), "exec:echo oops >&2; exit 3", false); err == nil || !strings.Contains(err.Error(), "oops") {
+		t.Errorf("Expected a failing command's stderr in the error, got %v", err)
+	}
+}
+
+func TestSources_ExecTimeout(t *testing.T) {
+	start := time.Now()
+	_, _, err := execSource{timeout: 50 * time.Millisecond}.Fetch(t.Context(), "exec:sleep 5")
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("Expected the command to time out, got %v", err)
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Errorf("Expected the command to be killed at its timeout, took %v", time.Since(start))
+	}
+}
+
+// staticSource serves one document for every URL
+type staticSource string
+
+func (s staticSource) Fetch(context.Context, string) ([]byte, http.Header, error) {
+	return []byte(s), nil, nil
+}
+
+func TestWithSource(t *testing.T) {
+	f := newFetcher(t, setupTestDB(t), WithSource("test", staticSource(noGUIDFeed)))
+	feed := f.GetContentForURL(t.Context(), "test:anything", false)
+	if len(feed.Posts) == 0 {
+		t.Errorf("Expected posts from the plugged in source, got %+v", feed)
+	}
+}
+
+func TestCommandFeed(t *testing.T) {
+	const jsonFeed = `{"version": "https://jsonfeed.org/version/1.1", "title": "Releases",
+"items": [{"id": "v1", "title": "v1.0.0", "url": "https://example.com/v1", "content_html": "<p>First</p>"}]}`
+
+	dir := t.TempDir()
+	script := filepath.Join(dir, "releases.sh")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\ncat <<'EOF'\n"+jsonFeed+"\nEOF\n"), 0o755); err != nil {
+		t.Fatalf("Failed to write script: %v", err)
+	}
+
+	db := setupTestDB(t)
+	url := "exec:" + script
+	slow := "exec:sleep 5"
+	f := newFetcher(t, db, WithCommandTimeouts(map[string]time.Duration{slow: 50 * time.Millisecond}))
+
+	feed := f.GetContentForURL(t.Context(), url, false)
+	if feed.Title != "Releases" || len(feed.Posts) != 1 || feed.Posts[0].Title != "v1.0.0" {
+		t.Errorf("Expected the JSON feed the command printed, got %+v", feed)
+	}
+	if cached, _ := db.LoadFeedCache(url); !strings.Contains(string(cached), "Releases") {
+		t.Errorf("Expected the command's output to be cached, got %q", cached)
+	}
+
+	if _, err := f.FetchURL(t.Context(), slow, false); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("Expected the feed's own timeout to apply, got %v", err)
+	}
+}
+
+const rulesFeed = `<?xml version="1.0"?>
+<rss version="2.0">
+<channel>
+<title>Repo</title>
+<item><guid>1</guid><title>Sponsored: buy this</title><description>ad</description></item>
+<item><guid>2</guid><title>Bump golang.org/x/net</title><author>dependabot@github.com (dependabot)</author><description>bump</description></item>
+<item><guid>3</guid><title>[release] v2.0.0</title><category>release</category><description>notes</description></item>
+<item><guid>4</guid><title>A real post</title><description>Mentions a security fix</description></item>
+</channel>
+</rss>`
+
+func TestRules(t *testing.T) {
+	rule := func(field, pattern string, action RuleAction, replacement string) Rule {
+		t.Helper()
+		r, err := NewRule(field, pattern, action, replacement)
+		if err != nil {
+			t.Fatalf("NewRule failed: %v", err)
+		}
+		return r
+	}
+
+	db := setupTestDB(t)
+	const url = "https://example.com/repo.xml"
+	if err := db.SaveFeedCache(url, []byte(rulesFeed)); err != nil {
+		t.Fatalf("Failed to save feed cache: %v", err)
+	}
+
+	global := []Rule{rule("title", `(?i)^sponsored`, RuleDrop, "")}
+	perFeed := map[string][]Rule{url: {
+		rule("author", `dependabot`, RuleMarkRead, ""),
+		rule("category", `^release$`, RuleStar, ""),
+		rule("title", `^\[release\] (.*)`, RuleRewrite, "Release $1"),
+		rule("", `security`, RuleStar, ""),
+	}}
+	f := newFetcher(t, db, WithRules(global, perFeed))
+
+	posts := make(map[string]Post)
+	for _, post := range f.GetContentForURL(t.Context(), url, true).Posts {
+		posts[post.UUID] = post
+	}
+
+	if _, ok := posts["1"]; ok || len(posts) != 3 {
+		t.Errorf("Expected the sponsored post to be dropped, got %d posts", len(posts))
+	}
+	if !posts["2"].Read || posts["2"].Starred {
+		t.Errorf("Expected the dependabot post to be read, got %+v", posts["2"])
+	}
+	if p := posts["3"]; !p.Starred || p.Title != "Release v2.0.0" {
+		t.Errorf("Expected the release to be starred and renamed, got %q starred=%v", p.Title, p.Starred)
+	}
+	if p := posts["4"]; !p.Starred || p.Read {
+		t.Errorf("Expected a rule on any field to match the content, got %+v", p)
+	}
+
+	// The global rules apply to every feed; the feed's own only to it
+	other := newFetcher(t, db, WithRules(global, map[string][]Rule{"https://example.com/other.xml": perFeed[url]}))
+	for _, post := range other.GetContentForURL(t.Context(), url, true).Posts {
+		if post.Read || post.Starred || post.UUID == "1" {
+			t.Errorf("Expected only the global rules to apply, got %+v", post)
+		}
+	}
+}
+
+func TestNewRule_Invalid(t *testing.T) {
+	for _, tt := range []struct {
+		field, pattern string
+		action         RuleAction
+	}{
+		{"title", "(", RuleDrop},
+		{"body", "x", RuleDrop},
+		{"title", "x", "hide"},
+		{"author", "x", RuleRewrite},
+	} {
+		if _, err := NewRule(tt.field, tt.pattern, tt.action, ""); err == nil {
+			t.Errorf("Expected NewRule(%q, %q, %q) to fail", tt.field, tt.pattern, tt.action)
+		}
+	}
+}
+
+func TestReadTracking_Stars(t *testing.T) {
+	db := setupTestDB(t)
+	feeds := Feeds{{URL: "https://example.com/feed", Posts: []Post{
+		{UUID: "a", Starred: true},
+		{UUID: "b"},
+		{UUID: "c", Starred: true},
+	}}}
+	feeds.Reindex()
+
+	// A star set by hand is kept over what rules say
+	feeds[0].Posts[1].Starred = true
+	feeds[0].Posts[2].Starred = false
+	if err := feeds.WriteStars(db, []Post{feeds[0].Posts[1], feeds[0].Posts[2]}); err != nil {
+		t.Fatalf("WriteStars failed: %v", err)
+	}
+
+	fresh := Feeds{{URL: "https://example.com/feed", Posts: []Post{
+		{UUID: "a", Starred: true},
+		{UUID: "b"},
+		{UUID: "c", Starred: true},
+	}}}
+	if err := fresh.ReadTracking(db); err != nil {
+		t.Fatalf("ReadTracking failed: %v", err)
+	}
+	for i, want := range []bool{true, true, false} {
+		if got := fresh[0].Posts[i].Starred; got != want {
+			t.Errorf("Post %s: expected starred=%v, got %v", fresh[0].Posts[i].UUID, want, got)
+		}
+	}
+
+	// Starring an unread post saves no read state, so a rule marking it read
+	// on a later fetch still applies
+	marked := Feeds{{URL: "https://example.com/feed", Posts: []Post{
+		{UUID: "a", Starred: true},
+		{UUID: "b", Read: true},
+		{UUID: "c", Starred: true},
+	}}}
+	if err := marked.ReadTracking(db); err != nil {
+		t.Fatalf("ReadTracking failed: %v", err)
+	}
+	if !marked[0].Posts[1].Read {
+		t.Error("Expected starring a post not to keep it unread over rules")
+	}
+}
+
+func TestGroupDuplicates(t *testing.T) {
+	day := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	posts := []Post{
+		{FeedID: 0, UUID: "https://blog.example/post", Link: "https://blog.example/post", Title: "A post"},
+		{FeedID: 1, UUID: "x", Link: "http://www.blog.example/post/?utm_source=planet", Title: "A post (via Planet)"},
+		{FeedID: 0, UUID: "tag:blog.example,2026:1", Link: "https://blog.example/1", Title: "One"},
+		{FeedID: 2, UUID: "tag:blog.example,2026:1", Link: "https://mirror.example/1", Title: "One, mirrored"},
+		{FeedID: 0, UUID: "sha256:aa", Title: "Release notes!", Published: day},
+		{FeedID: 1, UUID: "sha256:bb", Title: "release notes", Published: day.Add(time.Hour)},
+		{FeedID: 2, UUID: "sha256:cc", Title: "Release notes", Published: day.Add(7 * 24 * time.Hour)},
+		{FeedID: 1, UUID: "https://blog.example/other", Link: "https://blog.example/other?page=2", Title: "Other"},
+		// Small numbered GUIDs are only unique within their feed
+		{FeedID: 1, UUID: "42", Link: "https://a.example/42", Title: "Forty two"},
+		{FeedID: 2, UUID: "42", Link: "https://b.example/42", Title: "Something else"},
+	}
+
+	groups := GroupDuplicates(posts)
+	var sizes []int
+	for _, group := range groups {
+		sizes = append(sizes, len(group))
+	}
+	if want := []int{2, 2, 2, 1, 1, 1, 1}; !slices.Equal(sizes, want) {
+		t.Errorf("Expected groups of %v, got %v", want, sizes)
+	}
+	if groups[0][0].Title != "A post" {
+		t.Errorf("Expected the first copy to lead its group, got %q", groups[0][0].Title)
+	}
+}
+
+func TestGroupDuplicates_SameFeed(t *testing.T) {
+	// A changelog feed linking each release to the same page is not copies
+	posts := []Post{
+		{FeedID: 0, UUID: "v1.2", Link: "https://app.example/changelog#v1-2"},
+		{FeedID: 0, UUID: "v1.1", Link: "https://app.example/changelog#v1-1"},
+		{FeedID: 0, UUID: "status-1", Link: "https://status.example/"},
+		{FeedID: 0, UUID: "status-2", Link: "https://status.example/"},
+		{FeedID: 1, UUID: "p1", Link: "https://status.example/"},
+	}
+
+	groups := GroupDuplicates(posts)
+	var sizes []int
+	for _, group := range groups {
+		sizes = append(sizes, len(group))
+	}
+	if want := []int{1, 1, 2, 1}; !slices.Equal(sizes, want) {
+		t.Errorf("Expected groups of %v, got %v", want, sizes)
+	}
+
+	feeds := Feeds{
+		{URL: "https://status.example/feed", Posts: []Post{
+			{UUID: "status-1", Link: "https://status.example/", Read: true},
+			{UUID: "status-2", Link: "https://status.example/"},
+		}},
+	}
+	feeds.Reindex()
+	feeds.shareReadState()
+	if feeds[0].Posts[1].Read {
+		t.Error("Expected a post sharing a link within its feed to stay unread")
+	}
+}
+
+func TestReadTracking_SharesReadStateWithCopies(t *testing.T) {
+	db := setupTestDB(t)
+	newFeeds := func() Feeds {
+		return Feeds{
+			{URL: "https://blog.example/feed", Posts: []Post{
+				{UUID: "1", Link: "https://blog.example/1"},
+				{UUID: "2", Link: "https://blog.example/2"},
+			}},
+			{URL: "https://planet.example/feed", Posts: []Post{
+				{UUID: "p1", Link: "https://blog.example/1"},
+				{UUID: "p2", Link: "https://blog.example/2"},
+			}},
+		}
+	}
+
+	feeds := newFeeds()
+	feeds.Reindex()
+	feeds[0].Posts[0].Read = true
+	if err := feeds.WritePosts(db, []Post{feeds[0].Posts[0]}); err != nil {
+		t.Fatalf("WritePosts failed: %v", err)
+	}
+
+	fresh := newFeeds()
+	fresh.Reindex()
+	if err := fresh.ReadTracking(db); err != nil {
+		t.Fatalf("ReadTracking failed: %v", err)
+	}
+	if !fresh[1].Posts[0].Read {
+		t.Error("Expected the copy of a read post to be read")
+	}
+	if fresh[0].Posts[1].Read || fresh[1].Posts[1].Read {
+		t.Error("Expected unrelated posts to stay unread")
+	}
+
+	found := fresh.FindCopies()
+	copies := found.With(fresh, []Post{fresh[0].Posts[1]})
+	if len(copies) != 2 || copies[1].UUID != "p2" {
+		t.Errorf("Expected the post and its copy, got %v", copies)
+	}
+	if first := found.First(copies); len(first) != 1 || first[0].UUID != copies[0].UUID {
+		t.Errorf("Expected only the first copy to be kept, got %v", first)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.Local)
+	feeds := Feeds{
+		{Title: "Lobsters", URL: "https://lobste.rs/rss", Posts: []Post{
+			{UUID: "l1", Title: "Rust 2.0", Published: now.AddDate(0, 0, -1)},
+			{UUID: "l2", Title: "Go generics", Content: "a rust comparison", Published: now.AddDate(0, 0, -20), Read: true},
+		}},
+		{Title: "Blog", URL: "https://blog.example/feed", Posts: []Post{
+			{UUID: "b1", Title: "Learning rust", Published: now.AddDate(0, 0, -3), Starred: true},
+			{UUID: "b2", Title: "Undated rust"},
+		}},
+	}
+	feeds.Reindex()
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		// Without filters, a query is a phrase in the content, as it was
+		// before searches had filters
+		{"rust", []string{"l2"}},
+		{"Rust Comparison", []string{"l2"}},
+		{"comparison rust", nil},
+		{`"is:read"`, nil},
+		{"RUST is:unread", []string{"l1", "b1", "b2"}},
+		{`"a rust" is:read`, []string{"l2"}},
+		{`"a rust" is:unread`, nil},
+		{"rust is:read", []string{"l2"}},
+		{"is:starred", []string{"b1"}},
+		{"rust feed:lobste", []string{"l1", "l2"}},
+		{"rust days:7", []string{"l1", "b1"}},
+		{"after:2026-03-07 before:2026-03-09", []string{"b1"}},
+		{"learning rust feed:blog", []string{"b1"}},
+	}
+	for _, tt := range tests {
+		s, err := ParseSearch("", tt.query)
+		if err != nil {
+			t.Fatalf("ParseSearch(%q) failed: %v", tt.query, err)
+		}
+		var got []string
+		for _, post := range feeds.Search(s, feeds.FindCopies(), now) {
+			got = append(got, post.UUID)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("Search(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"is:new", "after:yesterday", "days:0"} {
+		if _, err := ParseSearch("", bad); err == nil {
+			t.Errorf("Expected ParseSearch(%q) to fail", bad)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package rss
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// RuleAction is what a rule does to the posts it matches
+type RuleAction string
+
+// The things a rule can do to a post
+const (
+	// RuleDrop leaves the post out of its feed
+	RuleDrop RuleAction = "drop"
+	// RuleMarkRead marks the post as read, unless its read state was set by hand
+	RuleMarkRead RuleAction = "read"
+	// RuleStar stars the post, unless it was starred or unstarred by hand
+	RuleStar RuleAction = "star"
+	// RuleRewrite replaces the matches in the post's title
+	RuleRewrite RuleAction = "rewrite"
+)
+
+// Rule matches posts by a regular expression and acts on them
+type Rule struct {
+	// Field is the part of a post matched: "title", "content", "author" or
+	// "category". Empty matches any of them.
+	Field   string
+	Pattern *regexp.Regexp
+	Action  RuleAction
+	// Replacement is what RuleRewrite replaces matches with, and may refer to
+	// submatches as $1
+	Replacement string
+}
+
+var ruleFields = []string{"", "title", "content", "author", "category"}
+
+// NewRule checks and compiles a rule
+func NewRule(field, pattern string, action RuleAction, replacement string) (Rule, error) {
+	field = strings.ToLower(field)
+	if !slices.Contains(ruleFields, field) {
+		return Rule{}, fmt.Errorf("unknown rule field %q", field)
+	}
+
+	switch action {
+	case RuleDrop, RuleMarkRead, RuleStar:
+	case RuleRewrite:
+		if field != "" && field != "title" {
+			return Rule{}, fmt.Errorf("rewrite rules can only match the title")
+		}
+	default:
+		return Rule{}, fmt.Errorf("unknown rule action %q", action)
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return Rule{}, fmt.Errorf("compiling rule %q: %w", pattern, err)
+	}
+	return Rule{Field: field, Pattern: re, Action: action, Replacement: replacement}, nil
+}
+
+// WithRules applies rules to the posts of every feed, and the rules in feeds
+// to the posts of the feed at each URL after them
+func WithRules(rules []Rule, feeds map[string][]Rule) Option {
+	return func(f *Fetcher) error {
+		f.rules, f.feedRules = rules, feeds
+		return nil
+	}
+}
+
+// Matches reports whether the rule matches a post
+func (r Rule) Matches(post Post) bool {
+	match := func(field string) bool {
+		if r.Field != "" && r.Field != field {
+			return false
+		}
+		switch field {
+		case "title":
+			return r.Pattern.MatchString(post.Title)
+		case "content":
+			return r.Pattern.MatchString(post.Content)
+		case "author":
+			return slices.ContainsFunc(post.Authors, r.Pattern.MatchString)
+		case "category":
+			return slices.ContainsFunc(post.Categories, r.Pattern.MatchString)
+		}
+		return false
+	}
+	return slices.ContainsFunc(ruleFields[1:], match)
+}
+
+// applyRules runs the rules for the feed at url over its posts, returning the
+// posts left.
+func (f *Fetcher) applyRules(url string, posts []Post) []Post {
+	rules := f.rules
+	if feedRules := f.feedRules[url]; len(feedRules) > 0 {
+		rules = append(slices.Clip(rules), feedRules...)
+	}
+	if len(rules) == 0 {
+		return posts
+	}
+
+	kept := posts[:0]
+	for _, post := range posts {
+		if post, ok := ApplyRules(rules, post); ok {
+			kept = append(kept, post)
+		}
+	}
+	return kept
+}
+
+// ApplyRules runs rules over a post in order, returning it as changed, or
+// false if a rule drops it
+func ApplyRules(rules []Rule, post Post) (Post, bool) {
+	for _, rule := range rules {
+		if !rule.Matches(post) {
+			continue
+		}
+		switch rule.Action {
+		case RuleDrop:
+			return post, false
+		case RuleMarkRead:
+			post.Read = true
+		case RuleStar:
+			post.Starred = true
+		case RuleRewrite:
+			post.Title = rule.Pattern.ReplaceAllString(post.Title, rule.Replacement)
+		}
+	}
+	return post, true
+}
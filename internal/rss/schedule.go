@@ -0,0 +1,189 @@
+package rss
+
+import (
+	"bytes"
+	"encoding/xml"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// Refresh says which feeds GetAllContent fetches from the network
+type Refresh int
+
+const (
+	// PreferCache fetches only the feeds that have never been cached
+	PreferCache Refresh = iota
+	// RefreshDue fetches the feeds that are due, going by their schedule
+	RefreshDue
+	// RefreshAll fetches every feed
+	RefreshAll
+)
+
+// The bounds on how long a feed waits between fetches. Hints from the feed
+// can go past maxInterval up to maxHint, so a feed asking to be polled daily
+// is, but no hint stops a feed from being fetched for good.
+const (
+	minInterval = 15 * time.Minute
+	maxInterval = 12 * time.Hour
+	maxHint     = 7 * 24 * time.Hour
+)
+
+// due reports whether the feed at url should be fetched by a refresh
+func (f *Fetcher) due(url string, now time.Time) bool {
+	next, err := f.db.LoadFeedSchedule(url)
+	if err != nil {
+		return true
+	}
+	return !now.Before(next)
+}
+
+// cadencePosts is how many of a feed's newest posts its cadence is taken from
+const cadencePosts = 20
+
+// schedule records when the posts of the feed at url, just fetched, were
+// published, and when it is next due going by every post seen so far. Feeds
+// often carry only their last few posts, so the document alone can't say
+// how often they post.
+func (f *Fetcher) schedule(url string, feed *gofeed.Feed, data []byte, header http.Header, now time.Time) error {
+	if err := f.db.SavePostDates(url, postDates(feed)); err != nil {
+		return err
+	}
+	history, err := f.db.LoadPostDates(url, cadencePosts)
+	if err != nil {
+		return err
+	}
+	return f.db.SaveFeedSchedule(url, now.Add(nextInterval(feed, history, data, header, now)))
+}
+
+// postDates are when a feed's dated items were published, by UUID
+func postDates(feed *gofeed.Feed) map[string]time.Time {
+	dates := make(map[string]time.Time, len(feed.Items))
+	for _, item := range feed.Items {
+		switch {
+		case item.PublishedParsed != nil:
+			dates[postUUID(item)] = *item.PublishedParsed
+		case item.UpdatedParsed != nil:
+			dates[postUUID(item)] = *item.UpdatedParsed
+		}
+	}
+	return dates
+}
+
+// nextInterval is how long to wait before fetching a feed again. Its posting
+// cadence, from history, sets the pace, checking twice as often as it posts,
+// but never sooner than the feed or server ask with a TTL, sy:updatePeriod or
+// cache headers.
+func nextInterval(feed *gofeed.Feed, history []time.Time, data []byte, header http.Header, now time.Time) time.Duration {
+	interval := min(max(cadence(history)/2, minInterval), maxInterval)
+
+	hint := max(rssTTL(data), updatePeriod(feed), freshness(header, now))
+	return max(interval, min(hint, maxHint))
+}
+
+// cadence is the median time between a feed's newest posts, or maxInterval
+// for a feed with too few dated posts to tell.
+func cadence(history []time.Time) time.Duration {
+	if len(history) < 2 {
+		return maxInterval
+	}
+
+	dates := slices.Clone(history)
+	slices.SortFunc(dates, func(a, b time.Time) int { return b.Compare(a) })
+	dates = dates[:min(len(dates), cadencePosts)]
+
+	gaps := make([]time.Duration, 0, len(dates)-1)
+	for i := 1; i < len(dates); i++ {
+		gaps = append(gaps, dates[i-1].Sub(dates[i]))
+	}
+	slices.Sort(gaps)
+	return gaps[len(gaps)/2]
+}
+
+// rssTTL reads an RSS channel's <ttl>, the minutes it may be cached for,
+// which gofeed doesn't keep.
+func rssTTL(data []byte) time.Duration {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	d.Strict = false
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return 0
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Space != "" {
+			continue
+		}
+		switch start.Name.Local {
+		case "item", "entry":
+			// The channel's elements are all before its items
+			return 0
+		case "ttl":
+			var ttl string
+			if err := d.DecodeElement(&ttl, &start); err != nil {
+				return 0
+			}
+			minutes, err := strconv.Atoi(strings.TrimSpace(ttl))
+			if err != nil || minutes <= 0 {
+				return 0
+			}
+			return time.Duration(minutes) * time.Minute
+		}
+	}
+}
+
+var updatePeriods = map[string]time.Duration{
+	"hourly":  time.Hour,
+	"daily":   24 * time.Hour,
+	"weekly":  7 * 24 * time.Hour,
+	"monthly": 30 * 24 * time.Hour,
+	"yearly":  365 * 24 * time.Hour,
+}
+
+// updatePeriod reads the syndication module's sy:updatePeriod, spread over
+// sy:updateFrequency updates.
+func updatePeriod(feed *gofeed.Feed) time.Duration {
+	sy := feed.Extensions["sy"]
+	value := func(name string) string {
+		if exts := sy[name]; len(exts) > 0 {
+			return strings.TrimSpace(exts[0].Value)
+		}
+		return ""
+	}
+
+	period, ok := updatePeriods[strings.ToLower(value("updatePeriod"))]
+	if !ok {
+		return 0
+	}
+	if frequency, err := strconv.Atoi(value("updateFrequency")); err == nil && frequency > 1 {
+		period /= time.Duration(frequency)
+	}
+	return period
+}
+
+// freshness is how long a response may be cached for, from its Cache-Control
+// max-age or else its Expires.
+func freshness(header http.Header, now time.Time) time.Duration {
+	if header == nil {
+		return 0
+	}
+	for _, directive := range strings.Split(header.Get("Cache-Control"), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch strings.ToLower(name) {
+		case "no-cache", "no-store":
+			return 0
+		case "max-age":
+			if secs, err := strconv.Atoi(strings.Trim(value, `"`)); err == nil {
+				return max(time.Duration(secs)*time.Second, 0)
+			}
+		}
+	}
+	if expires, err := http.ParseTime(header.Get("Expires")); err == nil {
+		return max(expires.Sub(now), 0)
+	}
+	return 0
+}
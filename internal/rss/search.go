@@ -0,0 +1,210 @@
+package rss
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// searchDate is the layout of the dates in "after:" and "before:" filters
+const searchDate = "2006-01-02"
+
+// Search finds posts across feeds. Its query is words a post's title or
+// content must all contain, along with filters:
+//
+//	feed:word    posts from feeds whose title or URL contains word
+//	is:unread    unread posts, and likewise is:read and is:starred
+//	after:date   posts published on or after a date, as 2006-01-02
+//	before:date  posts published before a date
+//	days:n       posts published in the last n days
+//
+// Text in double quotes is a phrase the post's content must contain, and is
+// never a filter. A query without filters is all one phrase, as searches
+// were before filters.
+type Search struct {
+	Name  string
+	Query string
+
+	words   []string
+	phrases []string
+	feeds   []string
+	read    *bool
+	starred bool
+	after   time.Time
+	before  time.Time
+	days    int
+}
+
+// PhraseSearch finds the posts whose content contains query, ignoring case
+func PhraseSearch(name, query string) Search {
+	return Search{Name: name, Query: query, phrases: []string{strings.ToLower(unquote(query))}}
+}
+
+// unquote trims the space around a query and the quotes around it, if it is
+// all one quoted phrase
+func unquote(query string) string {
+	query = strings.TrimSpace(query)
+	if len(query) >= 2 && strings.HasPrefix(query, `"`) && strings.HasSuffix(query, `"`) &&
+		!strings.Contains(query[1:len(query)-1], `"`) {
+		return query[1 : len(query)-1]
+	}
+	return query
+}
+
+// searchFields splits a query at spaces, except within double quotes. Quoted
+// fields are returned without their quotes.
+func searchFields(query string) (fields []string, quoted []bool) {
+	var (
+		field    strings.Builder
+		inQuotes bool
+		started  bool
+	)
+	end := func() {
+		if started {
+			fields = append(fields, field.String())
+			quoted = append(quoted, inQuotes)
+		}
+		field.Reset()
+		started = false
+	}
+	for _, r := range query {
+		switch {
+		case r == '"':
+			end()
+			inQuotes = !inQuotes
+		case unicode.IsSpace(r) && !inQuotes:
+			end()
+		default:
+			field.WriteRune(r)
+			started = true
+		}
+	}
+	end()
+	return fields, quoted
+}
+
+// ParseSearch reads a search query, to be saved under name
+func ParseSearch(name, query string) (Search, error) {
+	s := Search{Name: name, Query: query}
+	filtered := false
+	fields, quoted := searchFields(query)
+	for i, field := range fields {
+		if quoted[i] {
+			s.phrases = append(s.phrases, strings.ToLower(field))
+			continue
+		}
+
+		filter, value, ok := strings.Cut(field, ":")
+		if !ok || value == "" {
+			s.words = append(s.words, strings.ToLower(field))
+			continue
+		}
+
+		var err error
+		switch strings.ToLower(filter) {
+		case "feed":
+			s.feeds = append(s.feeds, strings.ToLower(value))
+		case "is":
+			switch value := strings.ToLower(value); value {
+			case "unread", "read":
+				read := value == "read"
+				s.read = &read
+			case "starred":
+				s.starred = true
+			default:
+				return Search{}, fmt.Errorf("unknown filter %q", field)
+			}
+		case "after":
+			s.after, err = time.ParseInLocation(searchDate, value, time.Local)
+		case "before":
+			s.before, err = time.ParseInLocation(searchDate, value, time.Local)
+		case "days":
+			s.days, err = strconv.Atoi(value)
+			if err == nil && s.days <= 0 {
+				err = fmt.Errorf("must be a positive number")
+			}
+		default:
+			// Not a filter, e.g. a search for "c++:" or a time like 10:30
+			s.words = append(s.words, strings.ToLower(field))
+			continue
+		}
+		if err != nil {
+			return Search{}, fmt.Errorf("filter %q: %w", field, err)
+		}
+		filtered = true
+	}
+
+	if !filtered {
+		return PhraseSearch(name, query), nil
+	}
+	return s, nil
+}
+
+// Matches reports whether a post from feed matches the search at time now
+func (s Search) Matches(feed Feed, post Post, now time.Time) bool {
+	if s.read != nil && post.Read != *s.read {
+		return false
+	}
+	if s.starred && !post.Starred {
+		return false
+	}
+
+	if len(s.feeds) > 0 {
+		title, url := strings.ToLower(feed.Title), strings.ToLower(feed.URL)
+		found := false
+		for _, f := range s.feeds {
+			if strings.Contains(title, f) || strings.Contains(url, f) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if !s.after.IsZero() || !s.before.IsZero() || s.days > 0 {
+		if post.Published.IsZero() {
+			return false
+		}
+		if !s.after.IsZero() && post.Published.Before(s.after) {
+			return false
+		}
+		if !s.before.IsZero() && !post.Published.Before(s.before) {
+			return false
+		}
+		if s.days > 0 && post.Published.Before(now.AddDate(0, 0, -s.days)) {
+			return false
+		}
+	}
+
+	title, content := strings.ToLower(post.Title), strings.ToLower(post.Content)
+	for _, word := range s.words {
+		if !strings.Contains(title, word) && !strings.Contains(content, word) {
+			return false
+		}
+	}
+	for _, phrase := range s.phrases {
+		if !strings.Contains(content, phrase) {
+			return false
+		}
+	}
+	return true
+}
+
+// Search returns the posts in every feed matching s, newest first. A post
+// found in several feeds is returned once, going by copies.
+func (feeds Feeds) Search(s Search, copies *Copies, now time.Time) []Post {
+	var posts []Post
+	for _, feed := range feeds {
+		for _, post := range feed.Posts {
+			if s.Matches(feed, post, now) {
+				posts = append(posts, post)
+			}
+		}
+	}
+	SortPosts(posts)
+	return copies.First(posts)
+}
@@ -0,0 +1,165 @@
+package rss
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Source reads a feed's document from wherever it lives. The source for a
+// feed is picked by the scheme of its URL.
+type Source interface {
+	// Fetch returns the document at url, and for one fetched over HTTP the
+	// response's header, which can say how long the feed stays fresh
+	Fetch(ctx context.Context, url string) ([]byte, http.Header, error)
+}
+
+// defaultExecTimeout stops a stuck command from stalling a refresh
+const defaultExecTimeout = 30 * time.Second
+
+// WithSource fetches the feeds whose URLs have the given scheme from source,
+// in place of any default
+func WithSource(scheme string, source Source) Option {
+	return func(f *Fetcher) error {
+		f.sources[strings.ToLower(scheme)] = source
+		return nil
+	}
+}
+
+// defaultSources are the sources a Fetcher starts with: http and https feeds
+// are fetched over the network, file feeds read from disk, and exec feeds
+// read from a command's output.
+func (f *Fetcher) defaultSources() map[string]Source {
+	web := httpSource{f}
+	return map[string]Source{
+		"http":  web,
+		"https": web,
+		"file":  fileSource{},
+		"exec":  execSource{timeout: defaultExecTimeout},
+	}
+}
+
+// source picks the source for the feed at url
+func (f *Fetcher) source(url string) (Source, error) {
+	scheme, _, ok := strings.Cut(url, ":")
+	if !ok {
+		return nil, fmt.Errorf("%q has no scheme", url)
+	}
+	source, ok := f.sources[strings.ToLower(scheme)]
+	if !ok {
+		return nil, fmt.Errorf("unsupported feed scheme %q", scheme)
+	}
+	return source, nil
+}
+
+// httpSource fetches feeds over HTTP, with their credentials and proxy
+type httpSource struct {
+	f *Fetcher
+}
+
+func (s httpSource) Fetch(ctx context.Context, url string) ([]byte, http.Header, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if req, err = s.f.authorize(req, url); err != nil {
+		return nil, nil, err
+	}
+
+	resp, err := s.f.do(s.f.withFeedProxy(req, url))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading response body: %w", err)
+	}
+	return body, resp.Header, nil
+}
+
+// fileSource reads feeds from file:// URLs
+type fileSource struct{}
+
+func (fileSource) Fetch(_ context.Context, feedURL string) ([]byte, http.Header, error) {
+	u, err := url.Parse(feedURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	path := u.Path
+	if path == "" {
+		// file:feed.xml, relative to the working directory
+		path = u.Opaque
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, nil, nil
+}
+
+// execSource runs the shell command following "exec:" and reads the feed from
+// its output.
+type execSource struct {
+	timeout time.Duration
+	// timeouts holds the feeds with a timeout of their own
+	timeouts map[string]time.Duration
+}
+
+func (s execSource) Fetch(ctx context.Context, url string) ([]byte, http.Header, error) {
+	_, command, _ := strings.Cut(url, ":")
+	timeout := s.timeout
+	if t, ok := s.timeouts[url]; ok {
+		timeout = t
+	}
+	return runFeedCommand(ctx, command, timeout)
+}
+
+// WithCommandTimeouts sets how long the commands of the given exec feeds may
+// run, in place of the default, by URL
+func WithCommandTimeouts(timeouts map[string]time.Duration) Option {
+	return func(f *Fetcher) error {
+		f.sources["exec"] = execSource{timeout: defaultExecTimeout, timeouts: timeouts}
+		return nil
+	}
+}
+
+// runFeedCommand runs command with sh, returning what it prints. It is killed
+// if it runs past timeout.
+func runFeedCommand(ctx context.Context, command string, timeout time.Duration) ([]byte, http.Header, error) {
+	if strings.TrimSpace(command) == "" {
+		return nil, nil, fmt.Errorf("no command to run")
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	// A child left holding the output open mustn't keep us waiting after the
+	// shell is killed
+	cmd.WaitDelay = time.Second
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, nil, fmt.Errorf("command timed out after %s", timeout)
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, nil, fmt.Errorf("%w: %s", err, msg)
+		}
+		return nil, nil, err
+	}
+	return stdout.Bytes(), nil, nil
+}
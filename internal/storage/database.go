@@ -35,6 +35,10 @@ func New(path string) (*DB, error) {
 		_ = conn.Close()
 		return nil, fmt.Errorf("creating tables: %w", err)
 	}
+	if err := db.migrate(); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("migrating database: %w", err)
+	}
 
 	return db, nil
 }
@@ -59,9 +63,10 @@ func (db *DB) Close() error {
 func (db *DB) createTables() error {
 	_, err := db.conn.Exec(`
 		CREATE TABLE IF NOT EXISTS post_read_status (
-			uuid TEXT PRIMARY KEY,
 			feed_url TEXT NOT NULL,
-			read INTEGER NOT NULL DEFAULT 0
+			uuid TEXT NOT NULL,
+			read INTEGER NOT NULL DEFAULT 0,
+			PRIMARY KEY (feed_url, uuid)
 		);
 
 		CREATE TABLE IF NOT EXISTS cache_metadata (
@@ -75,11 +80,118 @@ func (db *DB) createTables() error {
 			fetched_at TEXT NOT NULL
 		);
 
-		CREATE INDEX IF NOT EXISTS idx_feed_url ON post_read_status(feed_url);
+		CREATE TABLE IF NOT EXISTS article_cache (
+			url TEXT PRIMARY KEY,
+			content TEXT NOT NULL,
+			fetched_at TEXT NOT NULL
+		);
+
+		CREATE TABLE IF NOT EXISTS image_cache (
+			url TEXT PRIMARY KEY,
+			content BLOB NOT NULL,
+			fetched_at TEXT NOT NULL
+		);
 	`)
 	return err
 }
 
+// migrations upgrade older databases in order; a database's PRAGMA
+// user_version is the number of migrations already applied to it.
+var migrations = []string{
+	// Key read status by feed URL as well as UUID. Posts without a GUID were
+	// all stored under an empty UUID and shared one flag, so they are dropped.
+	`
+		ALTER TABLE post_read_status RENAME TO post_read_status_old;
+
+		CREATE TABLE post_read_status (
+			feed_url TEXT NOT NULL,
+			uuid TEXT NOT NULL,
+			read INTEGER NOT NULL DEFAULT 0,
+			PRIMARY KEY (feed_url, uuid)
+		);
+
+		INSERT INTO post_read_status (feed_url, uuid, read)
+		SELECT feed_url, uuid, read FROM post_read_status_old WHERE uuid != '';
+
+		DROP TABLE post_read_status_old;
+	`,
+	// When each feed is next due to be fetched, so a refresh can skip those
+	// that won't have changed.
+	`
+		CREATE TABLE IF NOT EXISTS feed_schedule (
+			url TEXT PRIMARY KEY,
+			next_fetch TEXT NOT NULL
+		);
+	`,
+	// Star posts. Starred is null until a post is starred or unstarred by
+	// hand, so rules can star it in the meantime.
+	`
+		ALTER TABLE post_read_status ADD COLUMN starred INTEGER;
+	`,
+	// Searches saved from the UI, listed on the home view like feeds.
+	`
+		CREATE TABLE IF NOT EXISTS saved_searches (
+			name TEXT PRIMARY KEY,
+			query TEXT NOT NULL
+		);
+	`,
+	// When each feed's posts were published, kept past the posts leaving the
+	// feed, so a feed's posting cadence can be learnt over time.
+	`
+		CREATE TABLE IF NOT EXISTS post_dates (
+			feed_url TEXT NOT NULL,
+			uuid TEXT NOT NULL,
+			published INTEGER NOT NULL,
+			PRIMARY KEY (feed_url, uuid)
+		);
+	`,
+	// Make read nullable like starred, so starring a post doesn't save a read
+	// state that would stop rules marking it read later.
+	`
+		ALTER TABLE post_read_status RENAME TO post_read_status_old;
+
+		CREATE TABLE post_read_status (
+			feed_url TEXT NOT NULL,
+			uuid TEXT NOT NULL,
+			read INTEGER,
+			starred INTEGER,
+			PRIMARY KEY (feed_url, uuid)
+		);
+
+		INSERT INTO post_read_status (feed_url, uuid, read, starred)
+		SELECT feed_url, uuid, read, starred FROM post_read_status_old;
+
+		DROP TABLE post_read_status_old;
+	`,
+}
+
+func (db *DB) migrate() error {
+	var version int
+	if err := db.conn.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return fmt.Errorf("reading schema version: %w", err)
+	}
+
+	for i := version; i < len(migrations); i++ {
+		tx, err := db.conn.Begin()
+		if err != nil {
+			return fmt.Errorf("beginning transaction: %w", err)
+		}
+		if _, err := tx.Exec(migrations[i]); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("applying migration %d: %w", i+1, err)
+		}
+		if _, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, i+1)); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("setting schema version: %w", err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("committing migration %d: %w", i+1, err)
+		}
+	}
+
+	return nil
+}
+
 // PostReadStatus represents a post's read status in the database
 type PostReadStatus struct {
 	UUID    string
@@ -87,6 +199,12 @@ type PostReadStatus struct {
 	Read    bool
 }
 
+// PostKey identifies a post: its UUID is only unique within its feed
+type PostKey struct {
+	FeedURL string
+	UUID    string
+}
+
 // SavePostReadStatus saves the read status for a single post
 func (db *DB) SavePostReadStatus(uuid, feedURL string, read bool) error {
 	readInt := 0
@@ -97,7 +215,7 @@ func (db *DB) SavePostReadStatus(uuid, feedURL string, read bool) error {
 	_, err := db.conn.Exec(`
 		INSERT INTO post_read_status (uuid, feed_url, read)
 		VALUES (?, ?, ?)
-		ON CONFLICT(uuid) DO UPDATE SET read = excluded.read
+		ON CONFLICT(feed_url, uuid) DO UPDATE SET read = excluded.read
 	`, uuid, feedURL, readInt)
 
 	return err
@@ -105,6 +223,15 @@ func (db *DB) SavePostReadStatus(uuid, feedURL string, read bool) error {
 
 // SavePostReadStatuses saves multiple read statuses in a single transaction
 func (db *DB) SavePostReadStatuses(statuses []PostReadStatus) error {
+	return db.saveStatuses(`
+		INSERT INTO post_read_status (uuid, feed_url, read)
+		VALUES (?, ?, ?)
+		ON CONFLICT(feed_url, uuid) DO UPDATE SET read = excluded.read
+	`, statuses)
+}
+
+// saveStatuses runs the upsert query for each status in a single transaction
+func (db *DB) saveStatuses(query string, statuses []PostReadStatus) error {
 	tx, err := db.conn.Begin()
 	if err != nil {
 		return fmt.Errorf("beginning transaction: %w", err)
@@ -116,11 +243,7 @@ func (db *DB) SavePostReadStatuses(statuses []PostReadStatus) error {
 		}
 	}()
 
-	stmt, err := tx.Prepare(`
-		INSERT INTO post_read_status (uuid, feed_url, read)
-		VALUES (?, ?, ?)
-		ON CONFLICT(uuid) DO UPDATE SET read = excluded.read
-	`)
+	stmt, err := tx.Prepare(query)
 	if err != nil {
 		return fmt.Errorf("preparing statement: %w", err)
 	}
@@ -142,22 +265,69 @@ func (db *DB) SavePostReadStatuses(statuses []PostReadStatus) error {
 	return nil
 }
 
-// LoadPostReadStatuses returns a map of UUID to read status
-func (db *DB) LoadPostReadStatuses() (map[string]bool, error) {
-	rows, err := db.conn.Query(`SELECT uuid, read FROM post_read_status`)
+// ChangeSet collects read-status changes so only the posts that actually
+// changed are written, rather than every known post. Setting the same post
+// twice keeps the latest state.
+type ChangeSet struct {
+	statuses map[PostKey]PostReadStatus
+}
+
+// NewChangeSet creates an empty ChangeSet
+func NewChangeSet() *ChangeSet {
+	return &ChangeSet{statuses: make(map[PostKey]PostReadStatus)}
+}
+
+// Set records the new read status of a post
+func (c *ChangeSet) Set(uuid, feedURL string, read bool) {
+	c.statuses[PostKey{FeedURL: feedURL, UUID: uuid}] = PostReadStatus{
+		UUID:    uuid,
+		FeedURL: feedURL,
+		Read:    read,
+	}
+}
+
+// Len returns the number of posts in the set
+func (c *ChangeSet) Len() int {
+	return len(c.statuses)
+}
+
+// ApplyChangeSet writes a ChangeSet in a single transaction. Rows that already
+// hold the new status are left untouched.
+func (db *DB) ApplyChangeSet(changes *ChangeSet) error {
+	if changes.Len() == 0 {
+		return nil
+	}
+
+	statuses := make([]PostReadStatus, 0, changes.Len())
+	for _, status := range changes.statuses {
+		statuses = append(statuses, status)
+	}
+
+	return db.saveStatuses(`
+		INSERT INTO post_read_status (uuid, feed_url, read)
+		VALUES (?, ?, ?)
+		ON CONFLICT(feed_url, uuid) DO UPDATE SET read = excluded.read
+		WHERE post_read_status.read IS NOT excluded.read
+	`, statuses)
+}
+
+// LoadPostReadStatuses returns a map of post key to read status, for the
+// posts with one saved
+func (db *DB) LoadPostReadStatuses() (map[PostKey]bool, error) {
+	rows, err := db.conn.Query(`SELECT feed_url, uuid, read FROM post_read_status WHERE read IS NOT NULL`)
 	if err != nil {
 		return nil, fmt.Errorf("querying read statuses: %w", err)
 	}
 	defer func() { _ = rows.Close() }()
 
-	statuses := make(map[string]bool)
+	statuses := make(map[PostKey]bool)
 	for rows.Next() {
-		var uuid string
+		var key PostKey
 		var read int
-		if err := rows.Scan(&uuid, &read); err != nil {
+		if err := rows.Scan(&key.FeedURL, &key.UUID, &read); err != nil {
 			return nil, fmt.Errorf("scanning row: %w", err)
 		}
-		statuses[uuid] = read == 1
+		statuses[key] = read == 1
 	}
 
 	if err := rows.Err(); err != nil {
@@ -167,6 +337,43 @@ func (db *DB) LoadPostReadStatuses() (map[string]bool, error) {
 	return statuses, nil
 }
 
+// SavePostStarred stars or unstars a post. A post without a saved read state
+// is left without one, so rules still decide whether it is read.
+func (db *DB) SavePostStarred(uuid, feedURL string, starred bool) error {
+	_, err := db.conn.Exec(`
+		INSERT INTO post_read_status (uuid, feed_url, starred)
+		VALUES (?, ?, ?)
+		ON CONFLICT(feed_url, uuid) DO UPDATE SET starred = excluded.starred
+	`, uuid, feedURL, starred)
+	return err
+}
+
+// LoadPostStars returns the posts that were starred or unstarred by hand,
+// and whether each is starred
+func (db *DB) LoadPostStars() (map[PostKey]bool, error) {
+	rows, err := db.conn.Query(`SELECT feed_url, uuid, starred FROM post_read_status WHERE starred IS NOT NULL`)
+	if err != nil {
+		return nil, fmt.Errorf("querying stars: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	stars := make(map[PostKey]bool)
+	for rows.Next() {
+		var key PostKey
+		var starred bool
+		if err := rows.Scan(&key.FeedURL, &key.UUID, &starred); err != nil {
+			return nil, fmt.Errorf("scanning row: %w", err)
+		}
+		stars[key] = starred
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating rows: %w", err)
+	}
+
+	return stars, nil
+}
+
 // GetCacheTime retrieves the last fetch time from the database
 func (db *DB) GetCacheTime() (*time.Time, error) {
 	var value string
@@ -224,3 +431,205 @@ func (db *DB) ClearFeedCache() error {
 	_, err := db.conn.Exec(`DELETE FROM feed_cache`)
 	return err
 }
+
+// PruneCaches removes the images and articles cached before a time, so the
+// caches don't grow without bound. They are fetched again if needed.
+func (db *DB) PruneCaches(before time.Time) error {
+	cutoff := before.UTC().Format(time.RFC3339)
+	for _, table := range []string{"image_cache", "article_cache"} {
+		// fetched_at is stored with a local offset, which julianday turns
+		// into UTC for comparing
+		query := fmt.Sprintf(`DELETE FROM %s WHERE julianday(fetched_at) < julianday(?)`, table)
+		if _, err := db.conn.Exec(query, cutoff); err != nil {
+			return fmt.Errorf("pruning %s: %w", table, err)
+		}
+	}
+	return nil
+}
+
+// SaveFeedSchedule records when the feed at url is next due to be fetched
+func (db *DB) SaveFeedSchedule(url string, next time.Time) error {
+	_, err := db.conn.Exec(`
+		INSERT INTO feed_schedule (url, next_fetch)
+		VALUES (?, ?)
+		ON CONFLICT(url) DO UPDATE SET next_fetch = excluded.next_fetch
+	`, url, next.UTC().Format(time.RFC3339))
+	return err
+}
+
+// LoadFeedSchedule returns when the feed at url is next due to be fetched, or
+// the zero time if it has never been fetched
+func (db *DB) LoadFeedSchedule(url string) (time.Time, error) {
+	var value string
+	err := db.conn.QueryRow(`SELECT next_fetch FROM feed_schedule WHERE url = ?`, url).Scan(&value)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("querying feed schedule: %w", err)
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("parsing feed schedule: %w", err)
+	}
+	return t, nil
+}
+
+// maxPostDates is how many of a feed's newest post dates are kept
+const maxPostDates = 100
+
+// SavePostDates records when the posts of the feed at url were published, by
+// UUID, keeping only the newest maxPostDates.
+func (db *DB) SavePostDates(url string, dates map[string]time.Time) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO post_dates (feed_url, uuid, published)
+		VALUES (?, ?, ?)
+		ON CONFLICT(feed_url, uuid) DO UPDATE SET published = excluded.published
+	`)
+	if err != nil {
+		return fmt.Errorf("preparing statement: %w", err)
+	}
+	defer func() { _ = stmt.Close() }()
+
+	for uuid, published := range dates {
+		if _, err := stmt.Exec(url, uuid, published.Unix()); err != nil {
+			return fmt.Errorf("saving post date: %w", err)
+		}
+	}
+
+	if _, err := tx.Exec(`
+		DELETE FROM post_dates WHERE feed_url = ? AND uuid NOT IN (
+			SELECT uuid FROM post_dates WHERE feed_url = ? ORDER BY published DESC LIMIT ?
+		)
+	`, url, url, maxPostDates); err != nil {
+		return fmt.Errorf("pruning post dates: %w", err)
+	}
+	return tx.Commit()
+}
+
+// LoadPostDates returns when the newest limit posts recorded for the feed at
+// url were published, newest first
+func (db *DB) LoadPostDates(url string, limit int) ([]time.Time, error) {
+	rows, err := db.conn.Query(`
+		SELECT published FROM post_dates WHERE feed_url = ? ORDER BY published DESC LIMIT ?
+	`, url, limit)
+	if err != nil {
+		return nil, fmt.Errorf("querying post dates: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var dates []time.Time
+	for rows.Next() {
+		var published int64
+		if err := rows.Scan(&published); err != nil {
+			return nil, fmt.Errorf("scanning row: %w", err)
+		}
+		dates = append(dates, time.Unix(published, 0).UTC())
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating rows: %w", err)
+	}
+
+	return dates, nil
+}
+
+// SavedSearch is a search query saved under a name
+type SavedSearch struct {
+	Name  string
+	Query string
+}
+
+// SaveSearch saves a search query under name, replacing any saved under it
+func (db *DB) SaveSearch(name, query string) error {
+	_, err := db.conn.Exec(`
+		INSERT INTO saved_searches (name, query)
+		VALUES (?, ?)
+		ON CONFLICT(name) DO UPDATE SET query = excluded.query
+	`, name, query)
+	return err
+}
+
+// DeleteSearch removes the search saved under name
+func (db *DB) DeleteSearch(name string) error {
+	_, err := db.conn.Exec(`DELETE FROM saved_searches WHERE name = ?`, name)
+	return err
+}
+
+// LoadSearches returns the saved searches by name
+func (db *DB) LoadSearches() ([]SavedSearch, error) {
+	rows, err := db.conn.Query(`SELECT name, query FROM saved_searches ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("querying saved searches: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var searches []SavedSearch
+	for rows.Next() {
+		var search SavedSearch
+		if err := rows.Scan(&search.Name, &search.Query); err != nil {
+			return nil, fmt.Errorf("scanning row: %w", err)
+		}
+		searches = append(searches, search)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating rows: %w", err)
+	}
+
+	return searches, nil
+}
+
+// SaveImageCache stores a fetched image in the database
+func (db *DB) SaveImageCache(url string, content []byte) error {
+	_, err := db.conn.Exec(`
+		INSERT INTO image_cache (url, content, fetched_at)
+		VALUES (?, ?, ?)
+		ON CONFLICT(url) DO UPDATE SET content = excluded.content, fetched_at = excluded.fetched_at
+	`, url, content, time.Now().Format(time.RFC3339))
+	return err
+}
+
+// LoadImageCache retrieves a cached image from the database
+func (db *DB) LoadImageCache(url string) ([]byte, error) {
+	var content []byte
+	err := db.conn.QueryRow(`SELECT content FROM image_cache WHERE url = ?`, url).Scan(&content)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("querying image cache: %w", err)
+	}
+	return content, nil
+}
+
+// SaveArticleCache stores an article extracted from a post's page
+func (db *DB) SaveArticleCache(url, content string) error {
+	_, err := db.conn.Exec(`
+		INSERT INTO article_cache (url, content, fetched_at)
+		VALUES (?, ?, ?)
+		ON CONFLICT(url) DO UPDATE SET content = excluded.content, fetched_at = excluded.fetched_at
+	`, url, content, time.Now().Format(time.RFC3339))
+	return err
+}
+
+// LoadArticleCache retrieves a cached article, returning an empty string if
+// the page has not been extracted before
+func (db *DB) LoadArticleCache(url string) (string, error) {
+	var content string
+	err := db.conn.QueryRow(`SELECT content FROM article_cache WHERE url = ?`, url).Scan(&content)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("querying article cache: %w", err)
+	}
+	return content, nil
+}
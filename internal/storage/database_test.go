@@ -1,8 +1,11 @@
 package storage
 
 import (
+	"database/sql"
+	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
 	"testing"
 	"time"
 )
@@ -86,7 +89,7 @@ func TestSaveAndLoadPostReadStatus(t *testing.T) {
 		t.Errorf("Expected 1 status, got %d", len(statuses))
 	}
 
-	if !statuses["uuid-1"] {
+	if !statuses[PostKey{FeedURL: "http://example.com/feed", UUID: "uuid-1"}] {
 		t.Error("Expected uuid-1 to be read")
 	}
 }
@@ -112,7 +115,7 @@ func TestSavePostReadStatus_Update(t *testing.T) {
 		t.Fatalf("Failed to load post read statuses: %v", err)
 	}
 
-	if statuses["uuid-1"] {
+	if statuses[PostKey{FeedURL: "http://example.com/feed", UUID: "uuid-1"}] {
 		t.Error("Expected uuid-1 to be unread after update")
 	}
 }
@@ -141,13 +144,13 @@ func TestSavePostReadStatuses_Batch(t *testing.T) {
 		t.Errorf("Expected 3 statuses, got %d", len(loaded))
 	}
 
-	if !loaded["uuid-1"] {
+	if !loaded[PostKey{FeedURL: "http://example.com/feed1", UUID: "uuid-1"}] {
 		t.Error("Expected uuid-1 to be read")
 	}
-	if loaded["uuid-2"] {
+	if loaded[PostKey{FeedURL: "http://example.com/feed1", UUID: "uuid-2"}] {
 		t.Error("Expected uuid-2 to be unread")
 	}
-	if !loaded["uuid-3"] {
+	if !loaded[PostKey{FeedURL: "http://example.com/feed2", UUID: "uuid-3"}] {
 		t.Error("Expected uuid-3 to be read")
 	}
 }
@@ -388,3 +391,343 @@ func TestSaveFeedCache_BinaryContent(t *testing.T) {
 		}
 	}
 }
+
+func TestApplyChangeSet(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	err := db.SavePostReadStatuses([]PostReadStatus{
+		{UUID: "uuid-1", FeedURL: "http://example.com/feed", Read: false},
+		{UUID: "uuid-2", FeedURL: "http://example.com/feed", Read: true},
+	})
+	if err != nil {
+		t.Fatalf("Failed to save post read statuses: %v", err)
+	}
+
+	changes := NewChangeSet()
+	changes.Set("uuid-1", "http://example.com/feed", false)
+	changes.Set("uuid-1", "http://example.com/feed", true)
+	changes.Set("uuid-3", "http://example.com/feed", true)
+
+	if changes.Len() != 2 {
+		t.Errorf("Expected 2 changes, got %d", changes.Len())
+	}
+
+	if err := db.ApplyChangeSet(changes); err != nil {
+		t.Fatalf("Failed to apply change set: %v", err)
+	}
+
+	loaded, err := db.LoadPostReadStatuses()
+	if err != nil {
+		t.Fatalf("Failed to load post read statuses: %v", err)
+	}
+
+	if !loaded[PostKey{FeedURL: "http://example.com/feed", UUID: "uuid-1"}] {
+		t.Error("Expected the latest change to uuid-1 to win")
+	}
+	if !loaded[PostKey{FeedURL: "http://example.com/feed", UUID: "uuid-2"}] {
+		t.Error("Expected uuid-2, which was not in the change set, to be untouched")
+	}
+	if !loaded[PostKey{FeedURL: "http://example.com/feed", UUID: "uuid-3"}] {
+		t.Error("Expected new post uuid-3 to be inserted")
+	}
+}
+
+func TestApplyChangeSet_Empty(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	if err := db.ApplyChangeSet(NewChangeSet()); err != nil {
+		t.Errorf("Unexpected error applying empty change set: %v", err)
+	}
+}
+
+func TestSavePostReadStatus_SameUUIDAcrossFeeds(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	if err := db.SavePostReadStatus("shared", "http://example.com/feed1", true); err != nil {
+		t.Fatalf("Failed to save post read status: %v", err)
+	}
+	if err := db.SavePostReadStatus("shared", "http://example.com/feed2", false); err != nil {
+		t.Fatalf("Failed to save post read status: %v", err)
+	}
+
+	statuses, err := db.LoadPostReadStatuses()
+	if err != nil {
+		t.Fatalf("Failed to load post read statuses: %v", err)
+	}
+
+	if len(statuses) != 2 {
+		t.Errorf("Expected 2 statuses, got %d", len(statuses))
+	}
+	if !statuses[PostKey{FeedURL: "http://example.com/feed1", UUID: "shared"}] {
+		t.Error("Expected the post in feed1 to stay read")
+	}
+}
+
+func TestSavePostStarred_KeepsReadUnset(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	if err := db.SavePostStarred("starred", "http://example.com/feed", true); err != nil {
+		t.Fatalf("Failed to save star: %v", err)
+	}
+
+	statuses, err := db.LoadPostReadStatuses()
+	if err != nil {
+		t.Fatalf("Failed to load post read statuses: %v", err)
+	}
+	if len(statuses) != 0 {
+		t.Errorf("Expected starring a post not to save a read status, got %v", statuses)
+	}
+
+	// Marking the starred post read later is still saved
+	changes := NewChangeSet()
+	changes.Set("starred", "http://example.com/feed", true)
+	if err := db.ApplyChangeSet(changes); err != nil {
+		t.Fatalf("Failed to apply change set: %v", err)
+	}
+	statuses, err = db.LoadPostReadStatuses()
+	if err != nil {
+		t.Fatalf("Failed to load post read statuses: %v", err)
+	}
+	if !statuses[PostKey{FeedURL: "http://example.com/feed", UUID: "starred"}] {
+		t.Error("Expected the starred post to be marked read")
+	}
+
+	stars, err := db.LoadPostStars()
+	if err != nil {
+		t.Fatalf("Failed to load stars: %v", err)
+	}
+	if !stars[PostKey{FeedURL: "http://example.com/feed", UUID: "starred"}] {
+		t.Error("Expected the post to stay starred")
+	}
+}
+
+func TestMigrate_KeysReadStatusByFeed(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "old.db")
+
+	// Build a database with the original schema, keyed by UUID alone.
+	conn, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	_, err = conn.Exec(`
+		CREATE TABLE post_read_status (
+			uuid TEXT PRIMARY KEY,
+			feed_url TEXT NOT NULL,
+			read INTEGER NOT NULL DEFAULT 0
+		);
+		CREATE INDEX idx_feed_url ON post_read_status(feed_url);
+		INSERT INTO post_read_status (uuid, feed_url, read) VALUES
+			('guid-1', 'http://example.com/feed', 1),
+			('', 'http://example.com/feed', 1);
+	`)
+	_ = conn.Close()
+	if err != nil {
+		t.Fatalf("Failed to create old schema: %v", err)
+	}
+
+	db, err := New(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open and migrate database: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	statuses, err := db.LoadPostReadStatuses()
+	if err != nil {
+		t.Fatalf("Failed to load post read statuses: %v", err)
+	}
+
+	if len(statuses) != 1 {
+		t.Errorf("Expected the GUID-less row to be dropped, got %d statuses", len(statuses))
+	}
+	if !statuses[PostKey{FeedURL: "http://example.com/feed", UUID: "guid-1"}] {
+		t.Error("Expected guid-1 to keep its read status")
+	}
+
+	var version int
+	if err := db.conn.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		t.Fatalf("Failed to read schema version: %v", err)
+	}
+	if version != len(migrations) {
+		t.Errorf("Expected schema version %d, got %d", len(migrations), version)
+	}
+}
+
+func TestSaveAndLoadImageCache(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	url := "http://example.com/image.png"
+	content := []byte{0x89, 0x50, 0x4E, 0x47}
+
+	if err := db.SaveImageCache(url, content); err != nil {
+		t.Fatalf("Failed to save image cache: %v", err)
+	}
+
+	loaded, err := db.LoadImageCache(url)
+	if err != nil {
+		t.Fatalf("Failed to load image cache: %v", err)
+	}
+	if string(loaded) != string(content) {
+		t.Errorf("Expected %x, got %x", content, loaded)
+	}
+
+	missing, err := db.LoadImageCache("http://example.com/missing.png")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if missing != nil {
+		t.Error("Expected nil content for an uncached image")
+	}
+}
+
+func TestSaveAndLoadArticleCache(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	url := "http://example.com/posts/1"
+	if err := db.SaveArticleCache(url, "<p>Full article</p>"); err != nil {
+		t.Fatalf("Failed to save article cache: %v", err)
+	}
+
+	content, err := db.LoadArticleCache(url)
+	if err != nil {
+		t.Fatalf("Failed to load article cache: %v", err)
+	}
+	if content != "<p>Full article</p>" {
+		t.Errorf("Unexpected article %q", content)
+	}
+
+	missing, err := db.LoadArticleCache("http://example.com/posts/2")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if missing != "" {
+		t.Errorf("Expected no article for an uncached page, got %q", missing)
+	}
+}
+
+func TestSaveAndLoadFeedSchedule(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	url := "http://example.com/feed.xml"
+	next, err := db.LoadFeedSchedule(url)
+	if err != nil {
+		t.Fatalf("Failed to load feed schedule: %v", err)
+	}
+	if !next.IsZero() {
+		t.Errorf("Expected an unscheduled feed to have no next fetch, got %v", next)
+	}
+
+	want := time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+	if err := db.SaveFeedSchedule(url, want); err != nil {
+		t.Fatalf("Failed to save feed schedule: %v", err)
+	}
+	next, err = db.LoadFeedSchedule(url)
+	if err != nil {
+		t.Fatalf("Failed to load feed schedule: %v", err)
+	}
+	if !next.Equal(want) {
+		t.Errorf("Expected next fetch %v, got %v", want, next)
+	}
+}
+
+func TestSaveAndLoadSearches(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	for _, s := range []SavedSearch{
+		{Name: "rust", Query: "rust is:unread"},
+		{Name: "go", Query: "golang"},
+		{Name: "rust", Query: "rust days:7"},
+	} {
+		if err := db.SaveSearch(s.Name, s.Query); err != nil {
+			t.Fatalf("Failed to save search: %v", err)
+		}
+	}
+
+	searches, err := db.LoadSearches()
+	if err != nil {
+		t.Fatalf("Failed to load searches: %v", err)
+	}
+	want := []SavedSearch{{Name: "go", Query: "golang"}, {Name: "rust", Query: "rust days:7"}}
+	if !reflect.DeepEqual(searches, want) {
+		t.Errorf("Expected %v, got %v", want, searches)
+	}
+
+	if err := db.DeleteSearch("go"); err != nil {
+		t.Fatalf("Failed to delete search: %v", err)
+	}
+	searches, err = db.LoadSearches()
+	if err != nil {
+		t.Fatalf("Failed to load searches: %v", err)
+	}
+	if len(searches) != 1 || searches[0].Name != "rust" {
+		t.Errorf("Expected only rust to be left, got %v", searches)
+	}
+}
+
+func TestSaveAndLoadPostDates(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	url := "http://example.com/feed.xml"
+	base := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	dates := make(map[string]time.Time)
+	for i := range maxPostDates + 5 {
+		dates[fmt.Sprint(i)] = base.Add(time.Duration(i) * time.Hour)
+	}
+	if err := db.SavePostDates(url, dates); err != nil {
+		t.Fatalf("Failed to save post dates: %v", err)
+	}
+
+	got, err := db.LoadPostDates(url, 3)
+	if err != nil {
+		t.Fatalf("Failed to load post dates: %v", err)
+	}
+	newest := base.Add(time.Duration(maxPostDates+4) * time.Hour)
+	if len(got) != 3 || !got[0].Equal(newest) || !got[2].Equal(newest.Add(-2*time.Hour)) {
+		t.Errorf("Expected the 3 newest dates, got %v", got)
+	}
+
+	all, err := db.LoadPostDates(url, 1000)
+	if err != nil {
+		t.Fatalf("Failed to load post dates: %v", err)
+	}
+	if len(all) != maxPostDates {
+		t.Errorf("Expected %d dates to be kept, got %d", maxPostDates, len(all))
+	}
+}
+
+func TestPruneCaches(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	if err := db.SaveImageCache("http://example.com/a.png", []byte("png")); err != nil {
+		t.Fatalf("Failed to save image: %v", err)
+	}
+	if err := db.SaveArticleCache("http://example.com/post", "<p>article</p>"); err != nil {
+		t.Fatalf("Failed to save article: %v", err)
+	}
+
+	if err := db.PruneCaches(time.Now().Add(-time.Hour)); err != nil {
+		t.Fatalf("PruneCaches failed: %v", err)
+	}
+	if data, _ := db.LoadImageCache("http://example.com/a.png"); data == nil {
+		t.Error("Expected a recently cached image to be kept")
+	}
+
+	if err := db.PruneCaches(time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("PruneCaches failed: %v", err)
+	}
+	if data, _ := db.LoadImageCache("http://example.com/a.png"); data != nil {
+		t.Error("Expected an image cached before the cutoff to be removed")
+	}
+	if content, _ := db.LoadArticleCache("http://example.com/post"); content != "" {
+		t.Error("Expected an article cached before the cutoff to be removed")
+	}
+}
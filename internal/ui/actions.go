@@ -0,0 +1,279 @@
+package ui
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/isabelroses/izrss/internal/config"
+	"github.com/isabelroses/izrss/internal/export"
+	"github.com/isabelroses/izrss/internal/rss"
+)
+
+// action is a user-defined command from the config, bound to a key
+type action struct {
+	name    string
+	cmd     config.Command
+	binding key.Binding
+}
+
+type actionDoneMsg struct {
+	err  error
+	name string
+}
+
+// newActions builds the configured actions, ordered by name so they list the
+// same way every time.
+func newActions(commands map[string]config.Command) []action {
+	actions := make([]action, 0, len(commands))
+	for name, cmd := range commands {
+		if cmd.Key == "" || cmd.Run == "" {
+			log.Printf("command %q needs both a key and a command to run", name)
+			continue
+		}
+		actions = append(actions, action{
+			name:    name,
+			cmd:     cmd,
+			binding: key.NewBinding(key.WithKeys(cmd.Key), key.WithHelp(cmd.Key, name)),
+		})
+	}
+	sort.Slice(actions, func(i, j int) bool { return actions[i].name < actions[j].name })
+	return actions
+}
+
+// actionBindings returns the key bindings of the configured actions for the help
+func (m Model) actionBindings() []key.Binding {
+	bindings := make([]key.Binding, len(m.actions))
+	for i, a := range m.actions {
+		bindings[i] = a.binding
+	}
+	return bindings
+}
+
+// matchAction returns the action bound to msg, if there is one.
+func (m Model) matchAction(msg tea.KeyMsg) (action, bool) {
+	for _, a := range m.actions {
+		if key.Matches(msg, a.binding) {
+			return a, true
+		}
+	}
+	return action{}, false
+}
+
+// runAction runs an action for post. In the reader "{link}" follows the same
+// rules as the open key, so a count picks one of the post's links.
+func (m *Model) runAction(a action, post rss.Post) tea.Cmd {
+	link := post.Link
+	if m.context.curr == "reader" {
+		u, err := m.targetURL()
+		if err != nil {
+			return m.setStatus(err.Error())
+		}
+		link = u
+	}
+
+	cmd, err := command(a.cmd.Run, m.templateValues(post, link))
+	if err != nil {
+		return m.setStatus(fmt.Sprintf("Could not run %s: %v", a.name, err))
+	}
+
+	switch a.cmd.Input {
+	case "":
+	case "html":
+		cmd.Stdin = strings.NewReader(post.Content)
+	case "markdown":
+		md, err := export.ToMarkdown(post.Content)
+		if err != nil {
+			log.Printf("%v", err)
+			md = post.Content
+		}
+		cmd.Stdin = strings.NewReader(md)
+	default:
+		return m.setStatus(fmt.Sprintf("Unknown input %q for %s", a.cmd.Input, a.name))
+	}
+
+	if a.cmd.Interactive {
+		name := a.name
+		return tea.ExecProcess(cmd, func(err error) tea.Msg {
+			return actionDoneMsg{err: err, name: name}
+		})
+	}
+
+	if err := start(cmd); err != nil {
+		log.Printf("error running %s: %v", a.name, err)
+		return m.setStatus("Could not run " + a.name)
+	}
+	return m.setStatus("Ran " + a.name)
+}
+
+// templateValues are the values substituted into a command's arguments
+func (m *Model) templateValues(post rss.Post, link string) map[string]string {
+	feedURL := ""
+	if post.FeedID >= 0 && post.FeedID < len(m.context.feeds) {
+		feedURL = m.context.feeds[post.FeedID].URL
+	}
+	return map[string]string{
+		"link":     link,
+		"title":    post.Title,
+		"feed":     post.FeedTitle,
+		"feed_url": feedURL,
+	}
+}
+
+// command builds the command line run describes. Environment variables are
+// expanded before the placeholders are filled in, so a post's title can't
+// smuggle one in; nothing is passed through a shell.
+func command(run string, values map[string]string) (*exec.Cmd, error) {
+	args, err := splitArgs(run)
+	if err != nil {
+		return nil, err
+	}
+
+	pairs := make([]string, 0, 2*len(values))
+	for name, value := range values {
+		pairs = append(pairs, "{"+name+"}", value)
+	}
+	fill := strings.NewReplacer(pairs...)
+
+	for i, arg := range args {
+		args[i] = fill.Replace(arg)
+	}
+
+	if len(args) == 0 || args[0] == "" {
+		return nil, fmt.Errorf("no command to run")
+	}
+	return exec.Command(args[0], args[1:]...), nil
+}
+
+// splitArgs splits a command line into arguments on whitespace, keeping
+// anything in single or double quotes together. Environment variables are
+// expanded outside of single quotes, as a shell would, and split into
+// arguments unless they are in double quotes, so $PAGER can be "less -R".
+func splitArgs(s string) ([]string, error) {
+	var (
+		args  []string
+		arg   strings.Builder
+		text  strings.Builder
+		quote rune
+		// inArg is set once the argument has begun, which quotes do even
+		// when empty
+		inArg bool
+	)
+	end := func() {
+		if inArg {
+			args = append(args, arg.String())
+			arg.Reset()
+			inArg = false
+		}
+	}
+	// unquoted adds the unquoted text read so far, expanded and split on the
+	// whitespace it expands to.
+	unquoted := func() {
+		for _, r := range os.ExpandEnv(text.String()) {
+			if unicode.IsSpace(r) {
+				end()
+				continue
+			}
+			arg.WriteRune(r)
+			inArg = true
+		}
+		text.Reset()
+	}
+
+	for _, r := range s {
+		switch {
+		case quote != 0 && r == quote:
+			if quote == '"' {
+				arg.WriteString(os.ExpandEnv(text.String()))
+			} else {
+				arg.WriteString(text.String())
+			}
+			text.Reset()
+			quote = 0
+		case quote != 0:
+			text.WriteRune(r)
+		case r == '"' || r == '\'':
+			unquoted()
+			quote, inArg = r, true
+		case r == ' ' || r == '\t' || r == '\n':
+			unquoted()
+			end()
+		default:
+			text.WriteRune(r)
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	unquoted()
+	end()
+	return args, nil
+}
+
+// start runs a command in the background, away from the terminal bubbletea is
+// drawing to.
+func start(cmd *exec.Cmd) error {
+	cmd.Stdout, cmd.Stderr = io.Discard, io.Discard
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go func() { _ = cmd.Wait() }()
+	return nil
+}
+
+// openURL opens a URL with the configured command, or else the system's
+// default browser.
+func openURL(opener, url string) error {
+	if opener != "" {
+		if !strings.Contains(opener, "{link}") {
+			opener += " {link}"
+		}
+		cmd, err := command(opener, map[string]string{"link": url})
+		if err != nil {
+			return err
+		}
+		return start(cmd)
+	}
+
+	var cmd string
+	var args []string
+
+	switch runtime.GOOS {
+	case "windows":
+		cmd = "cmd"
+		args = []string{"/c", "start", url}
+	case "darwin":
+		cmd = "open"
+		args = []string{url}
+	default:
+		if isWSL() {
+			cmd = "cmd.exe"
+			args = []string{"/c", "start", url}
+		} else {
+			cmd = "xdg-open"
+			args = []string{url}
+		}
+	}
+
+	return start(exec.Command(cmd, args...))
+}
+
+// isWSL reports whether we are running under the Windows Subsystem for Linux,
+// whose kernel names itself after Microsoft.
+func isWSL() bool {
+	release, err := os.ReadFile("/proc/sys/kernel/osrelease")
+	if err != nil {
+		return false
+	}
+	return strings.Contains(strings.ToLower(string(release)), "microsoft")
+}
@@ -0,0 +1,118 @@
+package ui
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/isabelroses/izrss/internal/config"
+	"github.com/isabelroses/izrss/internal/rss"
+)
+
+func TestSplitArgs(t *testing.T) {
+	args, err := splitArgs(`notify-send "new post" '{title}'  -u low`)
+	if err != nil {
+		t.Fatalf("splitArgs failed: %v", err)
+	}
+	want := []string{"notify-send", "new post", "{title}", "-u", "low"}
+	if strings.Join(args, "|") != strings.Join(want, "|") {
+		t.Errorf("Expected %q, got %q", want, args)
+	}
+
+	t.Setenv("IZRSS_TEST", "expanded")
+	args, err = splitArgs(`echo $IZRSS_TEST "$IZRSS_TEST" '$IZRSS_TEST'`)
+	if err != nil {
+		t.Fatalf("splitArgs failed: %v", err)
+	}
+	want = []string{"echo", "expanded", "expanded", "$IZRSS_TEST"}
+	if strings.Join(args, "|") != strings.Join(want, "|") {
+		t.Errorf("Expected variables expanded outside single quotes, %q, got %q", want, args)
+	}
+
+	// An unquoted variable is split into arguments, as $PAGER often has some
+	t.Setenv("IZRSS_TEST_PAGER", "less  -R")
+	t.Setenv("IZRSS_TEST_EMPTY", "")
+	args, err = splitArgs(`$IZRSS_TEST_PAGER "$IZRSS_TEST_PAGER" $IZRSS_TEST_EMPTY "" x$IZRSS_TEST_PAGER`)
+	if err != nil {
+		t.Fatalf("splitArgs failed: %v", err)
+	}
+	want = []string{"less", "-R", "less  -R", "", "xless", "-R"}
+	if strings.Join(args, "|") != strings.Join(want, "|") {
+		t.Errorf("Expected unquoted variables split into arguments, %q, got %q", want, args)
+	}
+
+	if _, err := splitArgs(`echo "unterminated`); err == nil {
+		t.Error("Expected an error for an unterminated quote")
+	}
+}
+
+func TestCommand_FillsTemplate(t *testing.T) {
+	t.Setenv("IZRSS_TEST_BIN", "echo")
+
+	cmd, err := command("$IZRSS_TEST_BIN {title} --from={feed}", map[string]string{
+		"title": "$HOME {feed}",
+		"feed":  "Alpha",
+	})
+	if err != nil {
+		t.Fatalf("command failed: %v", err)
+	}
+
+	// The title is passed as is: neither expanded nor filled in again.
+	want := []string{"echo", "$HOME {feed}", "--from=Alpha"}
+	if strings.Join(cmd.Args, "|") != strings.Join(want, "|") {
+		t.Errorf("Expected %q, got %q", want, cmd.Args)
+	}
+}
+
+func TestNewActions(t *testing.T) {
+	actions := newActions(map[string]config.Command{
+		"pager":  {Key: "P", Run: "$PAGER"},
+		"mpv":    {Key: "M", Run: "mpv {link}"},
+		"no key": {Run: "true"},
+	})
+
+	if len(actions) != 2 || actions[0].name != "mpv" || actions[1].name != "pager" {
+		t.Errorf("Expected the complete actions in name order, got %v", actions)
+	}
+}
+
+func TestRunAction_PipesPost(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out")
+
+	m := newTestModel(t, testFeeds())
+	m.actions = newActions(map[string]config.Command{
+		"save": {Key: "S", Run: `sh -c 'cat > "$0"' ` + out, Input: "markdown"},
+	})
+	m.context.feeds[0].Posts[0].Content = "<p>Hello <strong>there</strong></p>"
+	m.loadContent(0)
+
+	_, cmd := m.handleKeys(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("S")})
+	if cmd == nil {
+		t.Fatal("Expected a status message")
+	}
+
+	var data []byte
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if data, _ = os.ReadFile(out); len(data) > 0 {
+			break
+		}
+	}
+	if got := strings.TrimSpace(string(data)); got != "Hello **there**" {
+		t.Errorf("Expected the post as markdown, got %q", got)
+	}
+}
+
+func TestRunAction_Reader(t *testing.T) {
+	m := newTestModel(t, rss.Feeds{})
+	m.actions = newActions(map[string]config.Command{"bad": {Key: "S", Run: `"unterminated`}})
+	m.context.curr = "reader"
+
+	updated, cmd := m.handleKeys(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("S")})
+	if cmd == nil || !strings.HasPrefix(updated.status, "Could not run bad") {
+		t.Errorf("Expected a failure status, got %q", updated.status)
+	}
+}
@@ -1,10 +1,15 @@
 package ui
 
 import (
+	"context"
+	"image"
 	"log"
+	"sync"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
 
+	"github.com/isabelroses/izrss/internal/export"
 	"github.com/isabelroses/izrss/internal/rss"
 )
 
@@ -17,11 +22,52 @@ type feedRefreshedMsg struct {
 	id    int
 }
 
+// imagesLoadedMsg carries the images fetched for the post identified by
+// feedID and uuid.
+type imagesLoadedMsg struct {
+	images map[string]image.Image
+	uuid   string
+	feedID int
+}
+
+// articleLoadedMsg carries the article extracted for the post identified by
+// feedID and uuid.
+type articleLoadedMsg struct {
+	err     error
+	content string
+	uuid    string
+	feedID  int
+}
+
+type exportDoneMsg struct {
+	err  error
+	path string
+}
+
+type clearStatusMsg struct {
+	id int
+}
+
+// statusTimeout is how long a status message stays before the help returns.
+const statusTimeout = 3 * time.Second
+
+// setStatus shows a transient message, clearing it after statusTimeout unless a
+// newer message has replaced it.
+func (m *Model) setStatus(status string) tea.Cmd {
+	m.statusID++
+	m.status = status
+
+	id := m.statusID
+	return tea.Tick(statusTimeout, func(time.Time) tea.Msg {
+		return clearStatusMsg{id: id}
+	})
+}
+
 // loadCachedFeeds loads feeds from cache only (no network) for a fast first paint.
 func (m Model) loadCachedFeeds() tea.Cmd {
-	fetcher, urls, db := m.fetcher, m.cfg.Urls, m.db
+	ctx, fetcher, urls, db := m.ctx, m.fetcher, m.cfg.FeedURLs(), m.db
 	return func() tea.Msg {
-		feeds := fetcher.GetAllContent(urls, true)
+		feeds := fetcher.GetAllContent(ctx, urls, rss.PreferCache)
 		if err := feeds.ReadTracking(db); err != nil {
 			log.Printf("error reading tracking: %v", err)
 		}
@@ -29,11 +75,22 @@ func (m Model) loadCachedFeeds() tea.Cmd {
 	}
 }
 
-// refreshAll re-fetches every feed off the update loop so the UI never blocks.
-func (m Model) refreshAll() tea.Cmd {
-	fetcher, urls, db := m.fetcher, m.cfg.Urls, m.db
+// refreshAll re-fetches feeds off the update loop so the UI never blocks. Only
+// the feeds that are due are fetched, unless forced. A refresh still running
+// is cancelled, its feeds left to this one.
+func (m Model) refreshAll(force bool) tea.Cmd {
+	fetcher, urls, db := m.fetcher, m.cfg.FeedURLs(), m.db
+	refresh := rss.RefreshDue
+	if force {
+		refresh = rss.RefreshAll
+	}
+	ctx, done := m.refresh.start(m.ctx)
 	return func() tea.Msg {
-		feeds := fetcher.GetAllContent(urls, false)
+		defer done()
+		feeds := fetcher.GetAllContent(ctx, urls, refresh)
+		if ctx.Err() != nil {
+			return nil
+		}
 		if err := feeds.ReadTracking(db); err != nil {
 			log.Printf("error reading tracking: %v", err)
 		}
@@ -42,12 +99,97 @@ func (m Model) refreshAll() tea.Cmd {
 }
 
 func (m Model) refreshFeed(id int, url string) tea.Cmd {
-	fetcher := m.fetcher
+	ctx, fetcher := m.ctx, m.fetcher
 	return func() tea.Msg {
-		return feedRefreshedMsg{id: id, posts: fetcher.GetPosts(url)}
+		posts := fetcher.GetPosts(ctx, url)
+		if ctx.Err() != nil {
+			return nil
+		}
+		return feedRefreshedMsg{id: id, posts: posts}
 	}
 }
 
+// refresher runs one refresh of every feed at a time
+type refresher struct {
+	mu     sync.Mutex
+	cancel context.CancelFunc
+}
+
+// start cancels the refresh in progress, if any, and returns the context for
+// the next, with the function to call once it is done.
+func (r *refresher) start(parent context.Context) (context.Context, context.CancelFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.cancel != nil {
+		r.cancel()
+	}
+	ctx, cancel := context.WithCancel(parent)
+	r.cancel = cancel
+	return ctx, cancel
+}
+
+// maxImageFetches is how many of a post's images are fetched at once
+const maxImageFetches = 4
+
+// fetchImages fetches a post's images off the update loop, so the text shows
+// straight away and the images fill in as they arrive.
+func (m Model) fetchImages(post rss.Post, srcs []string) tea.Cmd {
+	ctx, fetcher := m.ctx, m.fetcher
+	return func() tea.Msg {
+		var (
+			wg   sync.WaitGroup
+			mu   sync.Mutex
+			data = make(map[string][]byte, len(srcs))
+		)
+		// A post full of images shouldn't open a connection for each at once
+		limit := make(chan struct{}, maxImageFetches)
+		for _, src := range srcs {
+			wg.Add(1)
+			go func(src string) {
+				defer wg.Done()
+				limit <- struct{}{}
+				defer func() { <-limit }()
+
+				d, err := fetcher.FetchImage(ctx, src)
+				if err != nil {
+					log.Printf("could not fetch image: %v", err)
+				}
+				mu.Lock()
+				data[src] = d
+				mu.Unlock()
+			}(src)
+		}
+		wg.Wait()
+
+		return imagesLoadedMsg{images: decodeImages(data), uuid: post.UUID, feedID: post.FeedID}
+	}
+}
+
+// fetchArticle fetches and extracts the full article behind a post.
+func (m Model) fetchArticle(post rss.Post) tea.Cmd {
+	ctx, fetcher := m.ctx, m.fetcher
+	return func() tea.Msg {
+		content, err := fetcher.FetchArticle(ctx, post.Link)
+		return articleLoadedMsg{err: err, content: content, uuid: post.UUID, feedID: post.FeedID}
+	}
+}
+
+// exportPosts exports posts in the configured format off the update loop.
+func (m *Model) exportPosts(posts []rss.Post, title string) tea.Cmd {
+	format, err := export.ParseFormat(m.cfg.Export.Format)
+	if err != nil {
+		return m.setStatus(err.Error())
+	}
+
+	dir := m.cfg.Export.Dir
+	run := func() tea.Msg {
+		path, err := export.Write(posts, format, dir, title)
+		return exportDoneMsg{err: err, path: path}
+	}
+	return tea.Batch(m.setStatus("Exporting…"), run)
+}
+
 // reloadList re-renders the current listing view, keeping the cursor in place.
 // It is a no-op for the reader and search views.
 func (m *Model) reloadList() {
@@ -62,9 +204,7 @@ func (m *Model) reloadList() {
 	case "mixed":
 		m.loadMixed()
 	case "content":
-		if m.context.feed.ID >= 0 && m.context.feed.ID < len(m.context.feeds) {
-			m.loadContent(m.context.feed.ID)
-		}
+		m.reloadPosts()
 	default:
 		return
 	}
@@ -0,0 +1,138 @@
+package ui
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/isabelroses/izrss/internal/config"
+	"github.com/isabelroses/izrss/internal/rss"
+	"github.com/isabelroses/izrss/internal/storage"
+)
+
+func TestRefreshAll_CancelsPreviousAndOnQuit(t *testing.T) {
+	// The server never answers, so a refresh runs until it is cancelled.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	db, err := storage.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	fetcher, err := rss.NewFetcher(db, "2006-01-02")
+	if err != nil {
+		t.Fatalf("NewFetcher failed: %v", err)
+	}
+
+	cfg := config.Default()
+	cfg.Urls = []string{srv.URL + "/feed"}
+	m := NewModel(cfg, db, fetcher)
+
+	before := runtime.NumGoroutine()
+	run := func(cmd tea.Cmd) <-chan tea.Msg {
+		out := make(chan tea.Msg, 1)
+		go func() { out <- cmd() }()
+		return out
+	}
+	wait := func(out <-chan tea.Msg, what string) {
+		t.Helper()
+		select {
+		case msg := <-out:
+			if msg != nil {
+				t.Errorf("Expected a cancelled refresh to send nothing, got %T", msg)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Expected the refresh to stop %s", what)
+		}
+	}
+
+	first := run(m.refreshAll(false))
+	second := run(m.refreshAll(true))
+	wait(first, "once another started")
+
+	_, cmd := m.handleKeys(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("q")})
+	if cmd == nil {
+		t.Fatal("Expected quitting to return a command")
+	}
+	wait(second, "on quit")
+
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > before {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected no goroutines left running, went from %d to %d", before, runtime.NumGoroutine())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// fakeFetcher serves feeds from memory, so the UI can be tested without the
+// network
+type fakeFetcher struct {
+	feeds rss.Feeds
+}
+
+func (f fakeFetcher) GetAllContent(_ context.Context, urls []string, _ rss.Refresh) rss.Feeds {
+	feeds := make(rss.Feeds, 0, len(urls))
+	for _, url := range urls {
+		for _, feed := range f.feeds {
+			if feed.URL == url {
+				feeds = append(feeds, feed)
+			}
+		}
+	}
+	feeds.Reindex()
+	return feeds
+}
+
+func (f fakeFetcher) GetPosts(_ context.Context, url string) []rss.Post {
+	for _, feed := range f.feeds {
+		if feed.URL == url {
+			return feed.Posts
+		}
+	}
+	return nil
+}
+
+func (fakeFetcher) FetchImage(context.Context, string) ([]byte, error) {
+	return nil, errors.New("no images")
+}
+
+func (fakeFetcher) FetchArticle(context.Context, string) (string, error) {
+	return "", errors.New("no articles")
+}
+
+func (fakeFetcher) Download(context.Context, rss.Enclosure, string, func(int64, int64)) (string, error) {
+	return "", errors.New("no downloads")
+}
+
+func TestRefreshAll_UsesFetcher(t *testing.T) {
+	m := newTestModel(t, nil)
+	m.cfg.Urls = []string{"https://alpha.example/feed", "https://beta.example/feed"}
+	m.fetcher = fakeFetcher{feeds: testFeeds()}
+	m.loadHome()
+
+	msg, ok := m.refreshAll(false)().(feedsRefreshedMsg)
+	if !ok {
+		t.Fatal("Expected the refresh to deliver feeds")
+	}
+	updated, _ := m.Update(msg)
+	m2 := updated.(Model)
+
+	if len(m2.context.feeds) != 2 || m2.context.feeds[1].Title != "Beta" {
+		t.Errorf("Expected the fetcher's feeds, got %+v", m2.context.feeds)
+	}
+	if rows := m2.table.Rows(); len(rows) != 2 {
+		t.Errorf("Expected a row per feed on home, got %d", len(rows))
+	}
+}
@@ -1,15 +1,46 @@
 package ui
 
 import (
+	"image"
+
 	"github.com/isabelroses/izrss/internal/rss"
 )
 
-type context struct {
+// viewState is what the UI is showing: the page, and the feed and post open
+type viewState struct {
 	prev  string
 	curr  string
 	feeds rss.Feeds
 	post  rss.Post
 	feed  rss.Feed
+
+	// copies are the posts in feeds that are copies of one another, found
+	// when first needed after feeds change
+	copies *rss.Copies
+
+	// links found in the open post, and the state of the reader's link list
+	links      []link
+	linkCursor int
+	showLinks  bool
+	// count is a link number being typed in the reader, e.g. the 3 of "3o"
+	count string
+	// images holds the open post's images by source, nil if they failed to load
+	images map[string]image.Image
+	// article is the main content extracted from the open post's page, shown
+	// in place of the feed's content while fullArticle is set
+	article     string
+	fullArticle bool
+	// saving is the query of a search being named, while the search input
+	// asks for its name
+	saving string
+}
+
+// copies returns the posts in the feeds that are copies of one another
+func (m *Model) copies() *rss.Copies {
+	if m.context.copies == nil {
+		m.context.copies = m.context.feeds.FindCopies()
+	}
+	return m.context.copies
 }
 
 func (m *Model) swapPage(next string) {
@@ -17,5 +48,7 @@ func (m *Model) swapPage(next string) {
 	m.context.curr = next
 	if m.context.prev == "reader" {
 		m.viewport.Height = m.viewport.Height + 2
+		m.table.Focus()
+		m.clearImages(true)
 	}
 }
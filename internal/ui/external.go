@@ -0,0 +1,74 @@
+package ui
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/isabelroses/izrss/internal/export"
+)
+
+// externalDoneMsg reports that the pager or editor a post was opened in has
+// exited, so its temporary file can go.
+type externalDoneMsg struct {
+	err  error
+	path string
+}
+
+// openExternal suspends the TUI and opens the reader's post in the program
+// named by the first of envs that is set, falling back to fallback. The reader
+// keeps its scroll position, so it comes back as it was left.
+func (m *Model) openExternal(fallback string, envs ...string) tea.Cmd {
+	program := fallback
+	for _, env := range envs {
+		if v := os.Getenv(env); v != "" {
+			program = v
+			break
+		}
+	}
+
+	post := m.context.post
+	post.Content = m.readerContent()
+
+	format := export.Markdown
+	ext := ".md"
+	if m.cfg.Reader.ExternalFormat == "html" {
+		format, ext = export.HTML, ".html"
+	}
+
+	doc, err := export.Document(post, format)
+	if err != nil {
+		log.Printf("%v", err)
+		return m.setStatus("Could not write the post out")
+	}
+
+	file, err := os.CreateTemp("", "izrss-*"+ext)
+	if err != nil {
+		log.Printf("could not create temp file: %v", err)
+		return m.setStatus("Could not write the post out")
+	}
+	_, err = file.WriteString(doc)
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		log.Printf("could not write post to %s: %v", file.Name(), err)
+		_ = os.Remove(file.Name())
+		return m.setStatus("Could not write the post out")
+	}
+
+	args, err := splitArgs(program)
+	if err != nil || len(args) == 0 {
+		_ = os.Remove(file.Name())
+		return m.setStatus(fmt.Sprintf("Could not run %q", program))
+	}
+
+	path := file.Name()
+	cmd := exec.Command(args[0], append(args[1:], path)...)
+	return tea.ExecProcess(cmd, func(err error) tea.Msg {
+		return externalDoneMsg{err: err, path: path}
+	})
+}
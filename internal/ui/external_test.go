@@ -0,0 +1,22 @@
+package ui
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/isabelroses/izrss/internal/rss"
+)
+
+func TestExternalDone_RemovesFile(t *testing.T) {
+	m := newTestModel(t, rss.Feeds{})
+	path := filepath.Join(t.TempDir(), "post.md")
+	if err := os.WriteFile(path, []byte("post"), 0o600); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	m.Update(externalDoneMsg{path: path})
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected the temporary file to be removed, got %v", err)
+	}
+}
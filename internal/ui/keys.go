@@ -1,10 +1,10 @@
 package ui
 
 import (
+	"fmt"
 	"log"
-	"os/exec"
-	"runtime"
 	"strings"
+	"time"
 
 	"github.com/charmbracelet/bubbles/key"
 	tea "github.com/charmbracelet/bubbletea"
@@ -14,28 +14,59 @@ import (
 )
 
 type keyMap struct {
-	Up         key.Binding
-	Down       key.Binding
-	JumpUp     key.Binding
-	JumpDown   key.Binding
-	Back       key.Binding
-	Help       key.Binding
-	Quit       key.Binding
-	Open       key.Binding
-	Refresh    key.Binding
-	RefreshAll key.Binding
-	Search     key.Binding
-	ToggleRead key.Binding
-	ReadAll    key.Binding
+	Up          key.Binding
+	Down        key.Binding
+	JumpUp      key.Binding
+	JumpDown    key.Binding
+	Back        key.Binding
+	Help        key.Binding
+	Quit        key.Binding
+	Open        key.Binding
+	Refresh     key.Binding
+	RefreshAll  key.Binding
+	ForceAll    key.Binding
+	Search      key.Binding
+	ToggleRead  key.Binding
+	Star        key.Binding
+	ReadAll     key.Binding
+	MarkAbove   key.Binding
+	MarkOlder   key.Binding
+	Undo        key.Binding
+	Links       key.Binding
+	Yank        key.Binding
+	Copy        key.Binding
+	FullArticle key.Binding
+	NextPost    key.Binding
+	PrevPost    key.Binding
+	NextUnread  key.Binding
+	PlayMedia   key.Binding
+	Download    key.Binding
+	Pager       key.Binding
+	Editor      key.Binding
+	Export      key.Binding
+	SaveSearch  key.Binding
+	Delete      key.Binding
 }
 
 func (k keyMap) ShortHelp(m Model) []key.Binding {
 	if m.context.curr == "reader" {
-		return []key.Binding{k.Open, k.ToggleRead, k.Quit}
+		if m.context.showLinks {
+			return []key.Binding{k.Open, k.Yank, k.Copy, k.Links}
+		}
+		return []key.Binding{k.Open, k.ToggleRead, k.NextUnread, k.Links, k.Help, k.Quit}
 	}
 	return []key.Binding{k.Help, k.Quit}
 }
 
+// exportHelp is the export binding described by what it exports on a page:
+// one post from the lists and the reader, or a whole feed or saved search
+// from the home view.
+func (k keyMap) exportHelp(what string) key.Binding {
+	b := k.Export
+	b.SetHelp(b.Help().Key, "export "+what)
+	return b
+}
+
 func (k keyMap) FullHelp(m Model) [][]key.Binding {
 	switch m.context.curr {
 	case "home":
@@ -44,9 +75,15 @@ func (k keyMap) FullHelp(m Model) [][]key.Binding {
 			{k.JumpUp, k.JumpDown},
 			{k.Back, k.Open},
 			{k.Search, k.ReadAll},
-			{k.Refresh, k.RefreshAll},
+			{k.Refresh, k.RefreshAll, k.ForceAll},
+			{k.MarkOlder, k.Undo},
+			{k.exportHelp("feed"), k.Delete},
 			{k.Help, k.Quit},
 		}
+	case "search":
+		return [][]key.Binding{
+			{k.SaveSearch},
+		}
 	case "content":
 		return [][]key.Binding{
 			{k.Up, k.Down},
@@ -55,7 +92,11 @@ func (k keyMap) FullHelp(m Model) [][]key.Binding {
 			{k.Search},
 			{k.Refresh, k.RefreshAll},
 			{k.ToggleRead, k.ReadAll},
+			{k.MarkAbove, k.MarkOlder},
+			{k.Star, k.Undo},
+			{k.exportHelp("post"), k.SaveSearch},
 			{k.Help, k.Quit},
+			m.actionBindings(),
 		}
 	case "mixed":
 		return [][]key.Binding{
@@ -63,113 +104,324 @@ func (k keyMap) FullHelp(m Model) [][]key.Binding {
 			{k.JumpUp, k.JumpDown},
 			{k.Back, k.Open},
 			{k.Search, k.ToggleRead},
+			{k.ReadAll, k.MarkAbove},
+			{k.MarkOlder, k.Undo},
+			{k.Star, k.exportHelp("post")},
+			{k.Help, k.Quit},
+			m.actionBindings(),
+		}
+	case "reader":
+		if m.context.showLinks {
+			return [][]key.Binding{
+				{k.Up, k.Down},
+				{k.Open, k.Links},
+				{k.Yank, k.Copy},
+			}
+		}
+		return [][]key.Binding{
+			{k.Back, k.Open},
+			{k.NextPost, k.PrevPost},
+			{k.NextUnread, k.ToggleRead},
+			{k.Star, k.FullArticle},
+			{k.Links},
+			{k.Yank, k.Copy},
+			{k.PlayMedia, k.Download},
+			{k.Pager, k.Editor},
+			{k.Undo, k.exportHelp("post")},
 			{k.Help, k.Quit},
+			m.actionBindings(),
 		}
 	default:
 		return [][]key.Binding{}
 	}
 }
 
+// ownsKey reports whether izrss acts on a key itself on the current page,
+// rather than leaving it to move the table or viewport. Their keymaps bind
+// some of the same keys, like "u" for half a page up, so those keys must not
+// reach them as well.
+func (m Model) ownsKey(msg tea.KeyMsg) bool {
+	if m.context.curr == "search" {
+		return false
+	}
+	if _, ok := m.matchAction(msg); ok {
+		return true
+	}
+	k := m.keys
+	return key.Matches(msg, k.JumpUp, k.JumpDown, k.Back, k.Help, k.Quit, k.Open,
+		k.Refresh, k.RefreshAll, k.ForceAll, k.Search, k.ToggleRead, k.Star,
+		k.ReadAll, k.MarkAbove, k.MarkOlder, k.Undo, k.Links, k.Yank, k.Copy,
+		k.FullArticle, k.NextPost, k.PrevPost, k.NextUnread, k.PlayMedia,
+		k.Download, k.Pager, k.Editor, k.Export, k.SaveSearch, k.Delete)
+}
+
 func (m Model) handleKeys(msg tea.KeyMsg) (Model, tea.Cmd) {
+	// Configured actions come first, so they can take over a built-in key.
+	if a, ok := m.matchAction(msg); ok && !m.context.showLinks {
+		switch m.context.curr {
+		case "reader":
+			return m, m.runAction(a, m.context.post)
+		case "content", "mixed":
+			if post, ok := m.selectedPost(); ok {
+				return m, m.runAction(a, post)
+			}
+		}
+	}
+
 	switch m.context.curr {
 	case "home":
 		switch {
 		case key.Matches(msg, m.keys.Open):
-			m.loadContent(m.table.Cursor())
-			m.table.SetCursor(0)
-			m.viewport.SetYOffset(0)
+			if m.table.Cursor() < m.homeRows() {
+				m.loadContent(m.table.Cursor())
+				m.table.SetCursor(0)
+				m.viewport.SetYOffset(0)
+			}
 
 		case key.Matches(msg, m.keys.Refresh):
-			id := m.table.Cursor()
-			return m, m.refreshFeed(id, m.context.feeds[id].URL)
+			// A saved search is refreshed with the feeds it draws from
+			if id := m.table.Cursor(); id < len(m.context.feeds) {
+				return m, m.refreshFeed(id, m.context.feeds[id].URL)
+			}
+			return m, m.refreshAll(false)
 
 		case key.Matches(msg, m.keys.RefreshAll):
-			return m, m.refreshAll()
+			return m, m.refreshAll(false)
+
+		case key.Matches(msg, m.keys.ForceAll):
+			return m, m.refreshAll(true)
 
 		case key.Matches(msg, m.keys.ReadAll):
-			rss.ReadAll(m.context.feeds, m.table.Cursor())
-			m.loadHome()
-			if err := m.context.feeds.WriteTracking(m.db); err != nil {
-				log.Printf("error writing tracking: %v", err)
+			if id := m.table.Cursor(); id < m.homeRows() {
+				m.markPosts("mark all as read", m.homeFeed(id).Posts, true)
+				m.loadHome()
+			}
+
+		case key.Matches(msg, m.keys.Export):
+			if id := m.table.Cursor(); id < m.homeRows() {
+				feed := m.homeFeed(id)
+				return m, m.exportPosts(feed.Posts, feed.Title)
 			}
+
+		case key.Matches(msg, m.keys.Delete):
+			return m, m.deleteSearch(m.table.Cursor())
 		}
 
 	case "content":
 		switch {
 		case key.Matches(msg, m.keys.Refresh):
+			// Searches are refreshed with the feeds they draw from
+			if m.context.feed.ID < 0 || m.context.feed.ID >= len(m.context.feeds) {
+				return m, m.refreshAll(false)
+			}
 			return m, m.refreshFeed(m.context.feed.ID, m.context.feed.URL)
 
+		case key.Matches(msg, m.keys.SaveSearch) && m.context.feed.ID == searchResultsID:
+			return m, m.startSavingSearch(m.filter.Value())
+
 		case key.Matches(msg, m.keys.Back):
 			m.loadHome()
 			m.table.SetCursor(m.context.feed.ID)
 			m.viewport.SetYOffset(0)
 
 		case key.Matches(msg, m.keys.Open):
-			m.loadReader()
+			return m, m.loadReader()
 
 		case key.Matches(msg, m.keys.ToggleRead):
-			rss.ToggleRead(m.context.feeds, m.context.feed.ID, m.table.Cursor())
-			m.loadContent(m.context.feed.ID)
-			if err := m.context.feeds.WriteTracking(m.db); err != nil {
-				log.Printf("error writing tracking: %v", err)
+			if post, ok := m.selectedPost(); ok {
+				m.markPosts("toggle read", []rss.Post{post}, !post.Read)
+				m.reloadPosts()
+			}
+
+		case key.Matches(msg, m.keys.Star):
+			if post, ok := m.selectedPost(); ok {
+				m.starPosts("toggle star", []rss.Post{post}, !post.Starred)
+				m.reloadPosts()
 			}
 
 		case key.Matches(msg, m.keys.ReadAll):
-			rss.ReadAll(m.context.feeds, m.context.feed.ID)
-			m.loadContent(m.context.feed.ID)
-			if err := m.context.feeds.WriteTracking(m.db); err != nil {
-				log.Printf("error writing tracking: %v", err)
+			m.markPosts("mark all as read", m.context.feed.Posts, true)
+			m.reloadPosts()
+
+		case key.Matches(msg, m.keys.MarkAbove):
+			m.markPosts("mark above as read", m.postsAbove(), true)
+			m.reloadPosts()
+
+		case key.Matches(msg, m.keys.Export):
+			if post, ok := m.selectedPost(); ok {
+				return m, m.exportPosts([]rss.Post{post}, post.Title)
 			}
 		}
 
 	case "mixed":
 		switch {
 		case key.Matches(msg, m.keys.Open):
-			m.loadReader()
+			return m, m.loadReader()
 
 		case key.Matches(msg, m.keys.ToggleRead):
-			rss.ToggleRead(m.context.feeds, m.context.feed.ID, m.table.Cursor())
-			m.loadMixed()
-			if err := m.context.feeds.WriteTracking(m.db); err != nil {
-				log.Printf("error writing tracking: %v", err)
+			if post, ok := m.selectedPost(); ok {
+				m.markPosts("toggle read", []rss.Post{post}, !post.Read)
+				m.loadMixed()
+			}
+
+		case key.Matches(msg, m.keys.Star):
+			if post, ok := m.selectedPost(); ok {
+				m.starPosts("toggle star", []rss.Post{post}, !post.Starred)
+				m.loadMixed()
 			}
 
 		case key.Matches(msg, m.keys.ReadAll):
-			rss.ReadAll(m.context.feeds, m.context.feed.ID)
+			m.markPosts("mark all as read", m.context.feed.Posts, true)
+			m.loadMixed()
+
+		case key.Matches(msg, m.keys.MarkAbove):
+			m.markPosts("mark above as read", m.postsAbove(), true)
 			m.loadMixed()
-			if err := m.context.feeds.WriteTracking(m.db); err != nil {
-				log.Printf("error writing tracking: %v", err)
+
+		case key.Matches(msg, m.keys.Export):
+			if post, ok := m.selectedPost(); ok {
+				return m, m.exportPosts([]rss.Post{post}, post.Title)
 			}
 		}
 
 	case "reader":
+		if s := msg.String(); len(s) == 1 && s[0] >= '0' && s[0] <= '9' {
+			m.context.count += s
+			return m, nil
+		}
+
+		if m.context.showLinks {
+			switch {
+			case key.Matches(msg, m.keys.Up):
+				m.moveLinkCursor(-1)
+				return m, nil
+			case key.Matches(msg, m.keys.Down):
+				m.moveLinkCursor(1)
+				return m, nil
+			case key.Matches(msg, m.keys.Back), key.Matches(msg, m.keys.Links):
+				m.context.showLinks = false
+				m.context.count = ""
+				return m, nil
+			}
+		}
+
 		switch {
+		case key.Matches(msg, m.keys.Links):
+			m.context.showLinks = true
+			m.context.count = ""
+
+		case key.Matches(msg, m.keys.FullArticle):
+			return m, m.toggleFullArticle()
+
+		case key.Matches(msg, m.keys.NextPost):
+			return m, m.readerStep(1)
+
+		case key.Matches(msg, m.keys.PrevPost):
+			return m, m.readerStep(-1)
+
+		case key.Matches(msg, m.keys.NextUnread):
+			return m, m.readerNextUnread()
+
+		case key.Matches(msg, m.keys.PlayMedia):
+			e, err := m.targetEnclosure()
+			if err != nil {
+				return m, m.setStatus(err.Error())
+			}
+			if err := playMedia(m.cfg.Media.Player, e.URL); err != nil {
+				log.Printf("error playing media: %v", err)
+				return m, m.setStatus("Could not start the media player")
+			}
+			return m, m.setStatus("Playing " + e.FileName())
+
+		case key.Matches(msg, m.keys.Download):
+			e, err := m.targetEnclosure()
+			if err != nil {
+				return m, m.setStatus(err.Error())
+			}
+			return m, m.startDownload(e)
+
+		case key.Matches(msg, m.keys.Pager):
+			return m, m.openExternal("less", "PAGER")
+
+		case key.Matches(msg, m.keys.Editor):
+			return m, m.openExternal("vi", "VISUAL", "EDITOR")
+
+		case key.Matches(msg, m.keys.Export):
+			post := m.context.post
+			post.Content = m.readerContent()
+			return m, m.exportPosts([]rss.Post{post}, post.Title)
+
+		case key.Matches(msg, m.keys.Yank):
+			u, err := m.targetURL()
+			if err != nil {
+				return m, m.setStatus(err.Error())
+			}
+			yankURL(u)
+			return m, m.setStatus("Yanked " + u)
+
+		case key.Matches(msg, m.keys.Copy):
+			u, err := m.targetURL()
+			if err != nil {
+				return m, m.setStatus(err.Error())
+			}
+			if err := copyURL(u); err != nil {
+				log.Printf("error copying URL: %v", err)
+				return m, m.setStatus("Could not copy to the clipboard")
+			}
+			return m, m.setStatus("Copied " + u)
+
 		case key.Matches(msg, m.keys.Back):
+			// The blurred table kept the cursor on the open post.
 			if m.context.prev == "mixed" {
 				m.loadMixed()
 			} else {
-				m.loadContent(m.context.feed.ID)
+				m.reloadPosts()
 			}
-			m.table.SetCursor(m.context.post.ID)
 			m.viewport.SetYOffset(0)
 
 		case key.Matches(msg, m.keys.Open):
-			if err := openURL(m.context.post.Link); err != nil {
+			u, err := m.targetURL()
+			if err != nil {
+				return m, m.setStatus(err.Error())
+			}
+			if err := openURL(m.cfg.Commands.Open, u); err != nil {
 				log.Printf("error opening URL: %v", err)
 			}
 
 		case key.Matches(msg, m.keys.ToggleRead):
-			rss.ToggleRead(m.context.feeds, m.context.feed.ID, m.context.post.ID)
-			m.loadContent(m.context.feed.ID)
-			if err := m.context.feeds.WriteTracking(m.db); err != nil {
-				log.Printf("error writing tracking: %v", err)
+			post := m.context.post
+			m.markPosts("toggle read", []rss.Post{post}, !post.Read)
+			m.context.post.Read = !post.Read
+
+		case key.Matches(msg, m.keys.Star):
+			post := m.context.post
+			m.starPosts("toggle star", []rss.Post{post}, !post.Starred)
+			m.context.post.Starred = !post.Starred
+			if m.context.post.Starred {
+				return m, m.setStatus("Starred")
 			}
+			return m, m.setStatus("Unstarred")
 		}
 
 	case "search":
+		// Naming a search to save takes every key but these
+		if m.context.saving != "" {
+			switch msg.String() {
+			case "enter":
+				return m, m.saveSearch(strings.TrimSpace(m.filter.Value()))
+			case "ctrl+c", "esc":
+				m.stopSavingSearch()
+			}
+			return m, nil
+		}
+
+		if key.Matches(msg, m.keys.SaveSearch) {
+			return m, m.startSavingSearch(m.filter.Value())
+		}
+
 		switch msg.String() {
 		case "enter":
-			m.loadSearchValues()
+			return m, m.loadSearchValues()
 
 		case "ctrl+c", "esc", "/":
 			m.loadContent(m.table.Cursor())
@@ -180,11 +432,40 @@ func (m Model) handleKeys(msg tea.KeyMsg) (Model, tea.Cmd) {
 
 	// Global keys
 	switch {
-	case key.Matches(msg, m.keys.JumpUp):
+	// The table holds the list position while the reader is open, so only jump
+	// it from the listing views.
+	case key.Matches(msg, m.keys.JumpUp) && m.context.curr != "reader":
 		m.table.MoveUp(5)
-	case key.Matches(msg, m.keys.JumpDown):
+	case key.Matches(msg, m.keys.JumpDown) && m.context.curr != "reader":
 		m.table.MoveDown(5)
 
+	case key.Matches(msg, m.keys.MarkOlder):
+		if m.context.curr == "search" || m.context.curr == "reader" {
+			break
+		}
+		days := m.cfg.List.OlderThanDays
+		posts := m.context.feeds.PostsOlderThan(time.Now().AddDate(0, 0, -days))
+		unread := 0
+		for _, post := range posts {
+			if !post.Read {
+				unread++
+			}
+		}
+		m.markPosts(fmt.Sprintf("mark older than %d days as read", days), posts, true)
+		m.reloadList()
+		return m, m.setStatus(fmt.Sprintf("Marked %d posts older than %d days as read", unread, days))
+
+	case key.Matches(msg, m.keys.Undo):
+		if m.context.curr == "search" {
+			break
+		}
+		status := m.undoLast()
+		if status == "" {
+			status = "Nothing to undo"
+		}
+		m.reloadList()
+		return m, m.setStatus(status)
+
 	case key.Matches(msg, m.keys.Search):
 		if m.context.curr != "search" {
 			m.loadSearch()
@@ -195,9 +476,10 @@ func (m Model) handleKeys(msg tea.KeyMsg) (Model, tea.Cmd) {
 		m.table.SetHeight(m.viewport.Height - lipgloss.Height(m.help.View(m.keys, m)))
 
 	case key.Matches(msg, m.keys.Quit):
-		if err := m.context.feeds.WriteTracking(m.db); err != nil {
-			log.Printf("error writing tracking: %v", err)
-		}
+		// Every read-state change is saved as it happens, so there is nothing
+		// left to write here, only fetches to stop.
+		m.cancel()
+		m.clearImages(true)
 		return m, tea.Quit
 	}
 
@@ -243,7 +525,11 @@ var defaultKeyMap = keyMap{
 	),
 	RefreshAll: key.NewBinding(
 		key.WithKeys("R"),
-		key.WithHelp("R", "refresh all"),
+		key.WithHelp("R", "refresh due feeds"),
+	),
+	ForceAll: key.NewBinding(
+		key.WithKeys("ctrl+r"),
+		key.WithHelp("ctrl+r", "refresh all"),
 	),
 	Search: key.NewBinding(
 		key.WithKeys("/"),
@@ -253,41 +539,80 @@ var defaultKeyMap = keyMap{
 		key.WithKeys("x"),
 		key.WithHelp("x", "toggle read"),
 	),
+	Star: key.NewBinding(
+		key.WithKeys("s"),
+		key.WithHelp("s", "toggle star"),
+	),
 	ReadAll: key.NewBinding(
 		key.WithKeys("X"),
 		key.WithHelp("X", "mark all as read"),
 	),
-}
-
-// openURL opens the specified URL in the default browser
-func openURL(url string) error {
-	var cmd string
-	var args []string
-
-	switch runtime.GOOS {
-	case "windows":
-		cmd = "cmd"
-		args = []string{"/c", "start", url}
-	case "darwin":
-		cmd = "open"
-		args = []string{url}
-	default:
-		if isWSL() {
-			cmd = "cmd.exe"
-			args = []string{"/c", "start", url}
-		} else {
-			cmd = "xdg-open"
-			args = []string{url}
-		}
-	}
-
-	return exec.Command(cmd, args...).Start()
-}
-
-func isWSL() bool {
-	releaseData, err := exec.Command("uname", "-r").Output()
-	if err != nil {
-		return false
-	}
-	return strings.Contains(strings.ToLower(string(releaseData)), "microsoft")
+	MarkAbove: key.NewBinding(
+		key.WithKeys("a"),
+		key.WithHelp("a", "mark above as read"),
+	),
+	MarkOlder: key.NewBinding(
+		key.WithKeys("A"),
+		key.WithHelp("A", "mark older as read"),
+	),
+	Undo: key.NewBinding(
+		key.WithKeys("u"),
+		key.WithHelp("u", "undo"),
+	),
+	Links: key.NewBinding(
+		key.WithKeys("L"),
+		key.WithHelp("L", "toggle links"),
+	),
+	Yank: key.NewBinding(
+		key.WithKeys("y"),
+		key.WithHelp("[n]y", "yank link"),
+	),
+	Copy: key.NewBinding(
+		key.WithKeys("c"),
+		key.WithHelp("[n]c", "copy link"),
+	),
+	FullArticle: key.NewBinding(
+		key.WithKeys("f"),
+		key.WithHelp("f", "full article"),
+	),
+	NextPost: key.NewBinding(
+		key.WithKeys("n"),
+		key.WithHelp("n", "next post"),
+	),
+	PrevPost: key.NewBinding(
+		key.WithKeys("p"),
+		key.WithHelp("p", "previous post"),
+	),
+	NextUnread: key.NewBinding(
+		key.WithKeys("N"),
+		key.WithHelp("N", "next unread"),
+	),
+	PlayMedia: key.NewBinding(
+		key.WithKeys("m"),
+		key.WithHelp("[n]m", "play media"),
+	),
+	Download: key.NewBinding(
+		key.WithKeys("d"),
+		key.WithHelp("[n]d", "download media"),
+	),
+	Pager: key.NewBinding(
+		key.WithKeys("v"),
+		key.WithHelp("v", "open in $PAGER"),
+	),
+	Editor: key.NewBinding(
+		key.WithKeys("e"),
+		key.WithHelp("e", "open in $EDITOR"),
+	),
+	Export: key.NewBinding(
+		key.WithKeys("E"),
+		key.WithHelp("E", "export"),
+	),
+	SaveSearch: key.NewBinding(
+		key.WithKeys("ctrl+s"),
+		key.WithHelp("ctrl+s", "save search"),
+	),
+	Delete: key.NewBinding(
+		key.WithKeys("D"),
+		key.WithHelp("D", "delete saved search"),
+	),
 }
@@ -0,0 +1,135 @@
+package ui
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/atotto/clipboard"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/mattn/go-runewidth"
+	"github.com/muesli/termenv"
+)
+
+// link is a hyperlink found in a post body
+type link struct {
+	text string
+	url  string
+}
+
+// extractLinks returns every distinct link in a post's HTML, in document
+// order, with relative links resolved against the post's own link.
+func extractLinks(content, base string) []link {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(content))
+	if err != nil {
+		log.Printf("could not parse post content for links: %v", err)
+		return nil
+	}
+
+	baseURL, _ := url.Parse(base)
+	seen := make(map[string]bool)
+
+	var links []link
+	doc.Find("a[href]").Each(func(_ int, s *goquery.Selection) {
+		href := strings.TrimSpace(s.AttrOr("href", ""))
+		if href == "" || strings.HasPrefix(href, "#") || strings.HasPrefix(href, "javascript:") {
+			return
+		}
+
+		if baseURL != nil {
+			if ref, err := url.Parse(href); err == nil {
+				href = baseURL.ResolveReference(ref).String()
+			}
+		}
+
+		if seen[href] {
+			return
+		}
+		seen[href] = true
+
+		text := strings.Join(strings.Fields(s.Text()), " ")
+		if text == "" {
+			text = href
+		}
+		links = append(links, link{text: text, url: href})
+	})
+
+	return links
+}
+
+// targetURL picks the URL a reader action applies to: the link numbered by a
+// typed count, the selected entry of the open link list, or the post itself.
+func (m *Model) targetURL() (string, error) {
+	count := m.context.count
+	m.context.count = ""
+
+	if count != "" {
+		n, err := strconv.Atoi(count)
+		if err != nil || n < 1 || n > len(m.context.links) {
+			return "", fmt.Errorf("no link numbered %s", count)
+		}
+		return m.context.links[n-1].url, nil
+	}
+
+	if m.context.showLinks {
+		if len(m.context.links) == 0 {
+			return "", fmt.Errorf("this post has no links")
+		}
+		return m.context.links[m.context.linkCursor].url, nil
+	}
+
+	return m.context.post.Link, nil
+}
+
+// yankURL copies a URL through the terminal with OSC 52, which also works over
+// SSH and inside tmux.
+func yankURL(u string) {
+	termenv.Copy(u)
+}
+
+// copyURL copies a URL to the system clipboard
+func copyURL(u string) error {
+	return clipboard.WriteAll(u)
+}
+
+func (m *Model) moveLinkCursor(delta int) {
+	m.context.linkCursor += delta
+	m.context.linkCursor = max(0, min(m.context.linkCursor, len(m.context.links)-1))
+}
+
+// linksView renders the numbered link list in place of the post, scrolled to
+// keep the selected link visible.
+func (m Model) linksView() string {
+	if len(m.context.links) == 0 {
+		return lipgloss.PlaceHorizontal(m.viewport.Width, lipgloss.Left, "This post has no links.")
+	}
+
+	height := max(m.viewport.Height, 1)
+	start := 0
+	if m.context.linkCursor >= height {
+		start = m.context.linkCursor - height + 1
+	}
+	end := min(start+height, len(m.context.links))
+
+	numWidth := len(strconv.Itoa(len(m.context.links)))
+	selected := TableStyles(m.cfg).Selected
+
+	lines := make([]string, 0, height)
+	for i := start; i < end; i++ {
+		l := m.context.links[i]
+		line := fmt.Sprintf("%*d  %s  %s", numWidth, i+1, l.text, m.styles.Help.Render(l.url))
+		if i == m.context.linkCursor {
+			line = fmt.Sprintf("%*d  %s  %s", numWidth, i+1, l.text, l.url)
+			line = selected.Render(runewidth.Truncate(line, m.viewport.Width, "…"))
+		}
+		lines = append(lines, line)
+	}
+	for len(lines) < height {
+		lines = append(lines, "")
+	}
+
+	return lipgloss.NewStyle().MaxWidth(m.viewport.Width).Render(strings.Join(lines, "\n"))
+}
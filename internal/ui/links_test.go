@@ -0,0 +1,63 @@
+package ui
+
+import (
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/isabelroses/izrss/internal/rss"
+)
+
+func TestExtractLinks(t *testing.T) {
+	content := `<p>See <a href="/docs">the docs</a>, <a href="https://example.org">an
+	external site</a>, <a href="#note">a footnote</a> and <a href="/docs">the docs again</a>.</p>
+	<a href="https://example.org/img"><img src="x.png"></a>`
+
+	links := extractLinks(content, "https://example.com/posts/1")
+
+	want := []link{
+		{text: "the docs", url: "https://example.com/docs"},
+		{text: "an external site", url: "https://example.org"},
+		{text: "https://example.org/img", url: "https://example.org/img"},
+	}
+	if len(links) != len(want) {
+		t.Fatalf("Expected %d links, got %d: %v", len(want), len(links), links)
+	}
+	for i, w := range want {
+		if links[i] != w {
+			t.Errorf("link %d: expected %v, got %v", i, w, links[i])
+		}
+	}
+}
+
+func TestReaderCount_TargetsNumberedLink(t *testing.T) {
+	m := newTestModel(t, rss.Feeds{})
+	m.context.curr = "reader"
+	m.context.post = rss.Post{Link: "https://example.com/post"}
+	m.context.links = []link{
+		{text: "one", url: "https://example.com/1"},
+		{text: "two", url: "https://example.com/2"},
+	}
+
+	updated, _ := m.handleKeys(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("2")})
+	if updated.context.count != "2" {
+		t.Fatalf("Expected count 2, got %q", updated.context.count)
+	}
+
+	u, err := updated.targetURL()
+	if err != nil || u != "https://example.com/2" {
+		t.Errorf("Expected link 2, got %q (%v)", u, err)
+	}
+	if updated.context.count != "" {
+		t.Error("Expected the count to be consumed")
+	}
+
+	if u, _ := updated.targetURL(); u != "https://example.com/post" {
+		t.Errorf("Expected the post link without a count, got %q", u)
+	}
+
+	updated.context.count = "9"
+	if _, err := updated.targetURL(); err == nil {
+		t.Error("Expected an error for a link number out of range")
+	}
+}
@@ -2,10 +2,13 @@ package ui
 
 import (
 	"fmt"
-	"log"
+	"html"
+	"image"
 	"strings"
+	"time"
 
 	"github.com/charmbracelet/bubbles/table"
+	tea "github.com/charmbracelet/bubbletea"
 	"github.com/mattn/go-runewidth"
 
 	"github.com/isabelroses/izrss/internal/rss"
@@ -23,7 +26,8 @@ func boldUnread(s string, width int) string {
 	return on + s + off
 }
 
-// loadHome loads the home view with the list of feeds
+// loadHome loads the home view with the list of feeds, and after them the
+// saved searches
 func (m *Model) loadHome() {
 	titleWidth := m.table.Width() - 10
 	columns := []table.Column{
@@ -31,17 +35,21 @@ func (m *Model) loadHome() {
 		{Title: "Title", Width: titleWidth},
 	}
 
-	rows := make([]table.Row, 0, len(m.context.feeds))
-	for _, feed := range m.context.feeds {
+	row := func(feed rss.Feed, title string) table.Row {
 		unread := feed.GetTotalUnreads()
-		fraction := fmt.Sprintf("%d/%d", unread, len(feed.Posts))
-
-		title := feed.Title
 		if unread > 0 {
 			title = boldUnread(title, titleWidth)
 		}
+		return table.Row{fmt.Sprintf("%d/%d", unread, len(feed.Posts)), title}
+	}
 
-		rows = append(rows, table.Row{fraction, title})
+	rows := make([]table.Row, 0, m.homeRows())
+	for _, feed := range m.context.feeds {
+		rows = append(rows, row(feed, feed.Title))
+	}
+	for i, search := range m.searches {
+		feed := m.searchFeed(len(m.context.feeds) + i)
+		rows = append(rows, row(feed, searchSymbol+" "+search.Name))
 	}
 
 	m.swapPage("home")
@@ -56,37 +64,68 @@ func (m *Model) postColumns() []table.Column {
 	}
 }
 
-func (m *Model) loadMixed() {
-	total := 0
-	for _, feed := range m.context.feeds {
-		total += len(feed.Posts)
-	}
-
-	posts := make([]rss.Post, 0, total)
-	for _, feed := range m.context.feeds {
-		posts = append(posts, feed.Posts...)
+// mixedColumns adds a feed column to the post columns, since posts from every
+// feed share the one list.
+func (m *Model) mixedColumns() []table.Column {
+	return []table.Column{
+		{Title: "", Width: 2},
+		{Title: "Date", Width: 15},
+		{Title: "Feed", Width: 20},
+		{Title: "Title", Width: m.table.Width() - 37},
 	}
+}
 
-	rss.SortPosts(posts)
-
-	rows := make([]table.Row, len(posts))
-	for i, post := range posts {
-		rows[i] = table.Row{rss.ReadSymbol(post.Read), post.Date, post.Title}
+func (m *Model) loadMixed() {
+	// Posts keep their FeedID and ID, so actions on a row still reach the
+	// underlying post in m.context.feeds. A post shared by several feeds is
+	// listed once, under the newest copy, with a count of the other feeds it
+	// came from.
+	groups := m.copies().Groups(m.context.feeds)
+	posts := make([]rss.Post, 0, len(groups))
+	rows := make([]table.Row, len(groups))
+	for i, group := range groups {
+		post := group[0]
+		feedTitle := post.FeedTitle
+		if len(group) > 1 {
+			feedTitle = fmt.Sprintf("%s +%d", feedTitle, len(group)-1)
+		}
+		posts = append(posts, post)
+		rows[i] = table.Row{rss.ReadSymbol(post.Read), post.Date, feedTitle, listTitle(post)}
 	}
 
-	m.context.feed = rss.Feed{Title: "Mixed", Posts: posts, ID: 0, URL: ""}
+	m.context.feed = rss.Feed{Title: "Mixed", Posts: posts, ID: -1, URL: ""}
 
-	m.loadNewTable(m.postColumns(), rows)
+	m.loadNewTable(m.mixedColumns(), rows)
 	m.swapPage("mixed")
 }
 
+// loadContent lists the posts on home view row id: a feed's, or those
+// matching a saved search, which come from any feed.
 func (m *Model) loadContent(id int) {
+	if id >= len(m.context.feeds) {
+		feed := m.searchFeed(id)
+		// The posts stay listed while the list is open, so reading one doesn't
+		// pull it from under the cursor of an "is:unread" search
+		if (m.context.curr == "content" || m.context.curr == "reader") && m.context.feed.ID == id {
+			feed.Posts = m.listedPosts()
+		}
+		rows := make([]table.Row, 0, len(feed.Posts))
+		for _, post := range feed.Posts {
+			rows = append(rows, table.Row{rss.ReadSymbol(post.Read), post.Date, post.FeedTitle, listTitle(post)})
+		}
+
+		m.loadNewTable(m.mixedColumns(), rows)
+		m.swapPage("content")
+		m.context.feed = feed
+		return
+	}
+
 	feed := m.context.feeds[id]
 	feed.ID = id
 
 	rows := make([]table.Row, 0, len(feed.Posts))
 	for _, post := range feed.Posts {
-		rows = append(rows, table.Row{rss.ReadSymbol(post.Read), post.Date, post.Title})
+		rows = append(rows, table.Row{rss.ReadSymbol(post.Read), post.Date, listTitle(post)})
 	}
 
 	m.loadNewTable(m.postColumns(), rows)
@@ -101,19 +140,32 @@ func (m *Model) loadSearch() {
 	m.filter.SetValue("")
 }
 
-func (m *Model) loadSearchValues() {
-	search := m.filter.Value()
+// loadSearchValues lists the posts matching the query in the search input. A
+// query with a filter that can't be read is searched for as text.
+func (m *Model) loadSearchValues() tea.Cmd {
+	var status tea.Cmd
+	search, err := rss.ParseSearch("", m.filter.Value())
+	if err != nil {
+		search = rss.PhraseSearch("", m.filter.Value())
+		status = m.setStatus(fmt.Sprintf("%v, searching for the text instead", err))
+	}
 
-	var filteredPosts []rss.Post
-	var rows []table.Row
+	m.showSearchResults(m.context.feeds.Search(search, m.copies(), time.Now()))
+	m.table.Focus()
+	m.filter.Blur()
+	m.table.SetCursor(0)
+	return status
+}
 
-	for _, feed := range m.context.feeds {
-		for _, post := range feed.Posts {
-			if strings.Contains(strings.ToLower(post.Content), strings.ToLower(search)) {
-				filteredPosts = append(filteredPosts, post)
-				rows = append(rows, table.Row{post.Date, post.Title})
-			}
-		}
+// searchResultsID is the ID of the list of posts found with the search input,
+// which isn't a row on the home view
+const searchResultsID = -2
+
+// showSearchResults lists posts found with the search input
+func (m *Model) showSearchResults(posts []rss.Post) {
+	rows := make([]table.Row, 0, len(posts))
+	for _, post := range posts {
+		rows = append(rows, table.Row{post.Date, listTitle(post)})
 	}
 
 	columns := []table.Column{
@@ -123,10 +175,18 @@ func (m *Model) loadSearchValues() {
 
 	m.loadNewTable(columns, rows)
 	m.swapPage("content")
-	m.context.feed.Posts = filteredPosts
-	m.table.Focus()
-	m.filter.Blur()
-	m.table.SetCursor(0)
+	m.context.feed = rss.Feed{Title: "Search", Posts: posts, ID: searchResultsID}
+}
+
+// reloadPosts lists the open post list again after its posts changed: the
+// feed or saved search it shows, or the search results as they were found.
+func (m *Model) reloadPosts() {
+	switch id := m.context.feed.ID; {
+	case id == searchResultsID:
+		m.showSearchResults(m.listedPosts())
+	case id >= 0 && id < m.homeRows():
+		m.loadContent(id)
+	}
 }
 
 func (m *Model) loadNewTable(columns []table.Column, rows []table.Row) {
@@ -141,28 +201,142 @@ func (m *Model) loadNewTable(columns []table.Column, rows []table.Row) {
 	m.table.SetCursor(cursor)
 }
 
-func (m *Model) loadReader() {
-	id := m.table.Cursor()
-	post := m.context.feed.Posts[id]
-	post.ID = id
+// selectedPost returns the post under the table cursor in a post listing.
+func (m *Model) selectedPost() (rss.Post, bool) {
+	cursor := m.table.Cursor()
+	if cursor < 0 || cursor >= len(m.context.feed.Posts) {
+		return rss.Post{}, false
+	}
+	return m.context.feed.Posts[cursor], true
+}
+
+// postsAbove returns the posts listed above the table cursor. An empty list
+// leaves the cursor at -1.
+func (m *Model) postsAbove() []rss.Post {
+	cursor := m.table.Cursor()
+	if cursor <= 0 || cursor > len(m.context.feed.Posts) {
+		return nil
+	}
+	return m.context.feed.Posts[:cursor]
+}
+
+func (m *Model) loadReader() tea.Cmd {
+	post, ok := m.selectedPost()
+	if !ok {
+		return nil
+	}
+
+	// Moving between posts reuses the open reader rather than swapping into it
+	if m.context.curr != "reader" {
+		m.swapPage("reader")
+		m.viewport.Height = m.viewport.Height - 2
+	}
+
+	// The listing holds a copy of each post, so take the read state from the
+	// feeds in case it changed since the list was drawn.
+	post.Read = m.isRead(post)
 
-	m.swapPage("reader")
 	m.context.post = post
+	m.context.linkCursor = 0
+	m.context.showLinks = false
+	m.context.count = ""
+	m.context.images = make(map[string]image.Image)
+	m.context.article = ""
+	m.context.fullArticle = false
 	m.viewport.YPosition = 0
+	m.viewport.SetYOffset(0)
 
-	// Render the post
-	fromMd, err := htmlToMarkdown.ConvertString(post.Content)
-	if err != nil {
-		log.Printf("could not convert html to markdown: %v", err)
-		fromMd = post.Content
+	// The table keeps the list position while the reader is open; blur it so
+	// scrolling the post doesn't move the cursor underneath.
+	m.table.Blur()
+
+	cmd := m.renderReader()
+	if post.FeedID < len(m.context.feeds) && m.cfg.Feed(m.context.feeds[post.FeedID].URL).Readability {
+		return tea.Batch(cmd, m.toggleFullArticle())
+	}
+	return cmd
+}
+
+// isRead reports the current read state of a post copied out of m.context.feeds
+func (m *Model) isRead(post rss.Post) bool {
+	if post.FeedID < 0 || post.FeedID >= len(m.context.feeds) || post.ID >= len(m.context.feeds[post.FeedID].Posts) {
+		return post.Read
 	}
+	return m.context.feeds[post.FeedID].Posts[post.ID].Read
+}
 
-	out, err := m.glam.Render(fromMd)
-	if err != nil {
-		log.Printf("could not render markdown: %v", err)
-		out = fromMd
+// readerStep opens the post delta rows away in the list the reader was opened
+// from. In the mixed view that list spans every feed.
+func (m *Model) readerStep(delta int) tea.Cmd {
+	row := m.table.Cursor() + delta
+	if row < 0 || row >= len(m.context.feed.Posts) {
+		return m.setStatus("No more posts")
+	}
+
+	m.table.SetCursor(row)
+	return m.loadReader()
+}
+
+// readerNextUnread opens the next unread post after the open one in the list
+// the reader was opened from.
+func (m *Model) readerNextUnread() tea.Cmd {
+	for row := m.table.Cursor() + 1; row < len(m.context.feed.Posts); row++ {
+		if !m.isRead(m.context.feed.Posts[row]) {
+			m.table.SetCursor(row)
+			return m.loadReader()
+		}
+	}
+	return m.setStatus("No more unread posts")
+}
+
+// readerContent is the HTML the reader shows: the extracted article when full
+// article mode is on and it has loaded, else the post's own content.
+func (m *Model) readerContent() string {
+	if m.context.fullArticle && m.context.article != "" {
+		return m.context.article
+	}
+
+	// Podcast and media feeds often carry their artwork on the item alone.
+	post := m.context.post
+	if m.cfg.Reader.Images && post.Image != "" && !strings.Contains(post.Content, post.Image) {
+		return fmt.Sprintf(`<img src="%s" alt="%s">`, html.EscapeString(post.Image), html.EscapeString(post.Title)) + post.Content
+	}
+	return post.Content
+}
+
+// renderReader (re)renders the open post, keeping the scroll position, and
+// returns a command fetching any images it is missing.
+func (m *Model) renderReader() tea.Cmd {
+	m.clearImages(false)
+
+	post := m.context.post
+	post.Content = m.readerContent()
+	m.context.links = extractLinks(post.Content, post.Link)
+
+	offset := m.viewport.YOffset
+	out, missing := m.renderPost(post)
+	m.viewport.SetContent(m.renderHeader(post) + out)
+	m.viewport.SetYOffset(offset)
+
+	if len(missing) == 0 || m.fetcher == nil {
+		return nil
+	}
+	return m.fetchImages(post, missing)
+}
+
+// toggleFullArticle switches the reader between the feed's content and the
+// article extracted from the post's page, fetching the article the first time.
+func (m *Model) toggleFullArticle() tea.Cmd {
+	m.context.fullArticle = !m.context.fullArticle
+
+	if m.context.fullArticle && m.context.article == "" {
+		if m.fetcher == nil || m.context.post.Link == "" {
+			m.context.fullArticle = false
+			return m.setStatus("This post has no page to load")
+		}
+		return tea.Batch(m.setStatus("Loading full article…"), m.fetchArticle(m.context.post))
 	}
 
-	m.viewport.SetContent(out)
-	m.viewport.Height = m.viewport.Height - 2
+	m.viewport.SetYOffset(0)
+	return m.renderReader()
 }
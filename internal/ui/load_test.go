@@ -5,6 +5,8 @@ import (
 	"testing"
 
 	"github.com/charmbracelet/bubbles/table"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
 	"github.com/mattn/go-runewidth"
 )
 
@@ -56,3 +58,44 @@ func TestBoldUnread_StaysWithinColumnWidth(t *testing.T) {
 		t.Errorf("expected trailing bold-off after truncation, got %q", out)
 	}
 }
+
+func TestReaderNavigation_CrossesFeedsInMixed(t *testing.T) {
+	feeds := testFeeds()
+	feeds[1].Posts[1].Read = true
+	m := newTestModel(t, feeds)
+	m.setupGlamour(80)
+	m.viewport = viewport.New(80, 20)
+	m.loadMixed()
+	m.loadReader()
+
+	if m.context.post.Title != "new beta" {
+		t.Fatalf("Expected to open the newest post, got %q", m.context.post.Title)
+	}
+
+	updated, _ := m.handleKeys(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("n")})
+	if updated.context.post.Title != "mid beta" {
+		t.Errorf("Expected next to open the second post, got %q", updated.context.post.Title)
+	}
+
+	updated, _ = updated.handleKeys(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("p")})
+	if updated.context.post.Title != "new beta" {
+		t.Errorf("Expected previous to return to the first post, got %q", updated.context.post.Title)
+	}
+
+	// "mid beta" is read, so next unread skips to the other feed's post.
+	updated, _ = updated.handleKeys(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("N")})
+	if updated.context.post.Title != "old alpha" || updated.context.post.FeedID != 0 {
+		t.Errorf("Expected next unread to cross into Alpha, got %q", updated.context.post.Title)
+	}
+	if updated.context.curr != "reader" || updated.context.prev != "mixed" {
+		t.Errorf("Expected to stay in the reader over the mixed view, got %q from %q", updated.context.curr, updated.context.prev)
+	}
+	if updated.viewport.Height != 18 {
+		t.Errorf("Expected the reader height to be reserved once, got %d", updated.viewport.Height)
+	}
+
+	_, cmd := updated.handleKeys(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("N")})
+	if cmd == nil {
+		t.Error("Expected a status message when there are no more unread posts")
+	}
+}
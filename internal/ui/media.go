@@ -0,0 +1,229 @@
+package ui
+
+import (
+	"fmt"
+	"log"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/isabelroses/izrss/internal/rss"
+)
+
+// mediaSymbol marks posts with an episode or other media in the post lists
+const mediaSymbol = "♪"
+
+// starSymbol marks starred posts in the post lists
+const starSymbol = "★"
+
+// progressInterval limits how often a download redraws its progress.
+const progressInterval = 250 * time.Millisecond
+
+// download is an enclosure being saved to the download directory
+type download struct {
+	url     string
+	name    string
+	written int64
+	total   int64
+}
+
+// downloadProgressMsg reports how far a download has got; events carries the
+// download's later messages.
+type downloadProgressMsg struct {
+	events  <-chan tea.Msg
+	url     string
+	written int64
+	total   int64
+}
+
+type downloadDoneMsg struct {
+	err  error
+	url  string
+	path string
+}
+
+// listTitle is a post's title as shown in the post lists
+func listTitle(post rss.Post) string {
+	title := post.Title
+	if post.HasMedia() {
+		title = mediaSymbol + " " + title
+	}
+	if post.Starred {
+		title = starSymbol + " " + title
+	}
+	return title
+}
+
+// enclosureLines describes each of a post's enclosures for the reader header,
+// numbered for the "[n]m" and "[n]d" keys.
+func enclosureLines(post rss.Post) []string {
+	lines := make([]string, 0, len(post.Enclosures))
+	for i, e := range post.Enclosures {
+		parts := []string{fmt.Sprintf("▶ %d %s", i+1, e.FileName())}
+		if e.Duration > 0 {
+			parts = append(parts, formatDuration(e.Duration))
+		}
+		if e.Length > 0 {
+			parts = append(parts, formatSize(e.Length))
+		}
+		if e.Type != "" {
+			parts = append(parts, e.Type)
+		}
+		lines = append(lines, strings.Join(parts, " · "))
+	}
+	return lines
+}
+
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Second)
+	h, m, s := int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60
+	if h > 0 {
+		return fmt.Sprintf("%d:%02d:%02d", h, m, s)
+	}
+	return fmt.Sprintf("%d:%02d", m, s)
+}
+
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGT"[exp])
+}
+
+// targetEnclosure picks the enclosure a media action applies to: the one
+// numbered by a typed count, else the post's first audio or video.
+func (m *Model) targetEnclosure() (rss.Enclosure, error) {
+	count := m.context.count
+	m.context.count = ""
+
+	enclosures := m.context.post.Enclosures
+	if count != "" {
+		n, err := strconv.Atoi(count)
+		if err != nil || n < 1 || n > len(enclosures) {
+			return rss.Enclosure{}, fmt.Errorf("no media numbered %s", count)
+		}
+		return enclosures[n-1], nil
+	}
+
+	for _, e := range enclosures {
+		if e.IsMedia() {
+			return e, nil
+		}
+	}
+	if len(enclosures) > 0 {
+		return enclosures[0], nil
+	}
+	return rss.Enclosure{}, fmt.Errorf("this post has no media")
+}
+
+// playMedia hands a URL to the configured player, leaving it running on its
+// own so the reader stays usable. The player is split into arguments like a
+// configured action.
+func playMedia(player, u string) error {
+	args, err := splitArgs(player)
+	if err != nil {
+		return fmt.Errorf("media player: %w", err)
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("no media player is configured")
+	}
+
+	if err := start(exec.Command(args[0], append(args[1:], u)...)); err != nil {
+		return fmt.Errorf("starting %s: %w", args[0], err)
+	}
+	return nil
+}
+
+// startDownload saves an enclosure to the download directory in the
+// background, reporting its progress to the footer.
+func (m *Model) startDownload(e rss.Enclosure) tea.Cmd {
+	for _, d := range m.downloads {
+		if d.url == e.URL {
+			return m.setStatus("Already downloading " + d.name)
+		}
+	}
+
+	if m.fetcher == nil {
+		return m.setStatus("Downloads are unavailable")
+	}
+
+	d := &download{url: e.URL, name: e.FileName(), total: e.Length}
+	m.downloads = append(m.downloads, d)
+
+	events := make(chan tea.Msg, 1)
+	ctx, fetcher, dir := m.ctx, m.fetcher, m.cfg.Media.DownloadDir
+	go func() {
+		var last time.Time
+		path, err := fetcher.Download(ctx, e, dir, func(written, total int64) {
+			if time.Since(last) < progressInterval {
+				return
+			}
+			last = time.Now()
+			// Drop updates the UI hasn't caught up with; the next will do.
+			select {
+			case events <- downloadProgressMsg{events: events, url: e.URL, written: written, total: total}:
+			default:
+			}
+		})
+		events <- downloadDoneMsg{err: err, url: e.URL, path: path}
+	}()
+
+	return tea.Batch(m.setStatus("Downloading "+d.name), waitForDownload(events))
+}
+
+func waitForDownload(events <-chan tea.Msg) tea.Cmd {
+	return func() tea.Msg {
+		return <-events
+	}
+}
+
+// updateDownload records a download's progress and waits for its next message.
+func (m *Model) updateDownload(msg downloadProgressMsg) tea.Cmd {
+	for _, d := range m.downloads {
+		if d.url == msg.url {
+			d.written, d.total = msg.written, msg.total
+		}
+	}
+	return waitForDownload(msg.events)
+}
+
+// finishDownload drops a finished download from the footer and reports where
+// it was saved.
+func (m *Model) finishDownload(msg downloadDoneMsg) tea.Cmd {
+	name := msg.url
+	for i, d := range m.downloads {
+		if d.url == msg.url {
+			name = d.name
+			m.downloads = append(m.downloads[:i], m.downloads[i+1:]...)
+			break
+		}
+	}
+
+	if msg.err != nil {
+		log.Printf("could not download media: %v", msg.err)
+		return m.setStatus("Could not download " + name)
+	}
+	return m.setStatus("Downloaded " + msg.path)
+}
+
+// downloadsView summarises the downloads in progress for the footer
+func (m Model) downloadsView() string {
+	parts := make([]string, 0, len(m.downloads))
+	for _, d := range m.downloads {
+		progress := formatSize(d.written)
+		if d.total > 0 {
+			progress = fmt.Sprintf("%d%%", d.written*100/d.total)
+		}
+		parts = append(parts, fmt.Sprintf("↓ %s %s", d.name, progress))
+	}
+	return strings.Join(parts, "  ")
+}
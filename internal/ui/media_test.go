@@ -0,0 +1,103 @@
+package ui
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/isabelroses/izrss/internal/rss"
+)
+
+var episode = rss.Post{
+	Title: "Episode 1",
+	Enclosures: []rss.Enclosure{
+		{URL: "https://example.com/notes.pdf", Type: "application/pdf"},
+		{URL: "https://example.com/ep1.mp3", Type: "audio/mpeg", Length: 3 << 20, Duration: 42*time.Minute + 10*time.Second},
+	},
+}
+
+func TestListTitle_MarksMedia(t *testing.T) {
+	if got := listTitle(episode); got != mediaSymbol+" Episode 1" {
+		t.Errorf("Expected a media indicator, got %q", got)
+	}
+	if got := listTitle(rss.Post{Title: "Text"}); got != "Text" {
+		t.Errorf("Expected a plain title, got %q", got)
+	}
+}
+
+func TestEnclosureLines(t *testing.T) {
+	lines := enclosureLines(episode)
+	if len(lines) != 2 {
+		t.Fatalf("Expected a line per enclosure, got %v", lines)
+	}
+	if want := "▶ 2 ep1.mp3 · 42:10 · 3.0 MB · audio/mpeg"; lines[1] != want {
+		t.Errorf("Expected %q, got %q", want, lines[1])
+	}
+}
+
+func TestTargetEnclosure(t *testing.T) {
+	m := newTestModel(t, rss.Feeds{})
+	m.context.post = episode
+
+	e, err := m.targetEnclosure()
+	if err != nil || e.URL != "https://example.com/ep1.mp3" {
+		t.Errorf("Expected the first audio enclosure by default, got %v (%v)", e, err)
+	}
+
+	m.context.count = "1"
+	e, err = m.targetEnclosure()
+	if err != nil || e.URL != "https://example.com/notes.pdf" {
+		t.Errorf("Expected the numbered enclosure, got %v (%v)", e, err)
+	}
+
+	m.context.post = rss.Post{}
+	m.context.curr = "reader"
+	_, cmd := m.handleKeys(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("m")})
+	if cmd == nil {
+		t.Error("Expected a status message for a post without media")
+	}
+}
+
+func TestDownloadProgress(t *testing.T) {
+	m := newTestModel(t, rss.Feeds{})
+	m.downloads = []*download{{url: "https://example.com/ep1.mp3", name: "ep1.mp3"}}
+
+	if cmd := m.updateDownload(downloadProgressMsg{url: "https://example.com/ep1.mp3", written: 50, total: 200}); cmd == nil {
+		t.Error("Expected to keep waiting for the download")
+	}
+	if got := m.downloadsView(); got != "↓ ep1.mp3 25%" {
+		t.Errorf("Expected the progress in the footer, got %q", got)
+	}
+	if !strings.Contains(m.footer(), "ep1.mp3 25%") {
+		t.Errorf("Expected the footer to show downloads, got %q", m.footer())
+	}
+
+	m.finishDownload(downloadDoneMsg{url: "https://example.com/ep1.mp3", err: errors.New("boom")})
+	if len(m.downloads) != 0 {
+		t.Errorf("Expected the download to be dropped, got %v", m.downloads)
+	}
+	if m.status != "Could not download ep1.mp3" {
+		t.Errorf("Expected a failure status, got %q", m.status)
+	}
+}
+
+func TestDownload_KeepsOffset(t *testing.T) {
+	feeds := testFeeds()
+	feeds[0].Posts[0].Content = strings.Repeat("<p>show notes</p>", 100)
+	feeds[0].Posts[0].Enclosures = episode.Enclosures
+	m := newTestModel(t, feeds)
+	m.setupGlamour(80)
+	m.viewport = viewport.New(80, 20)
+	m.loadContent(0)
+	m.loadReader()
+	m.viewport.SetYOffset(10)
+
+	update(t, m, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("d")})
+	if m.viewport.YOffset != 10 {
+		t.Errorf("Expected starting a download not to scroll the post, got offset %d", m.viewport.YOffset)
+	}
+}
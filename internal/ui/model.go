@@ -1,7 +1,11 @@
 package ui
 
 import (
+	"context"
+	"fmt"
+	"io"
 	"log"
+	"os"
 
 	"github.com/charmbracelet/bubbles/table"
 	"github.com/charmbracelet/bubbles/textinput"
@@ -12,6 +16,7 @@ import (
 	"github.com/muesli/termenv"
 
 	"github.com/isabelroses/izrss/internal/config"
+	"github.com/isabelroses/izrss/internal/images"
 	"github.com/isabelroses/izrss/internal/rss"
 	"github.com/isabelroses/izrss/internal/storage"
 )
@@ -21,31 +26,68 @@ type Model struct {
 	help     HelpModel
 	keys     keyMap
 	glam     *glamour.TermRenderer
-	context  context
+	context  viewState
 	viewport viewport.Model
 	filter   textinput.Model
 	table    table.Model
 	ready    bool
 
+	// undo holds read-state actions that can be reverted, newest last
+	undo []undoEntry
+	// status is a transient message shown in place of the short help
+	status   string
+	statusID int
+	// downloads are the enclosures being downloaded, oldest first
+	downloads []*download
+	// actions are the commands configured under [commands.actions]
+	actions []action
+	// searches are listed on the home view after the feeds
+	searches []savedSearch
+
+	// ctx is cancelled when the program quits, stopping any fetches
+	ctx    context.Context
+	cancel context.CancelFunc
+	// refresh cancels a refresh of every feed that another has replaced
+	refresh *refresher
+
 	// Dependencies
 	cfg       *config.Config
 	db        *storage.DB
-	fetcher   *rss.Fetcher
+	fetcher   Fetcher
 	styles    *Styles
 	glamStyle string
+	glamWidth int
+
+	imageProtocol images.Protocol
+	// term is the terminal, for the kitty image escapes sent outside the view
+	term  io.Writer
+	kitty *kittyImages
 }
 
+// Fetcher loads feeds, and the images, articles and media their posts link
+// to. The UI only needs this much of rss.Fetcher, so it can be run against
+// something other than the network.
+type Fetcher interface {
+	GetAllContent(ctx context.Context, urls []string, refresh rss.Refresh) rss.Feeds
+	GetPosts(ctx context.Context, url string) []rss.Post
+	FetchImage(ctx context.Context, url string) ([]byte, error)
+	FetchArticle(ctx context.Context, link string) (string, error)
+	Download(ctx context.Context, e rss.Enclosure, dir string, progress func(written, total int64)) (string, error)
+}
+
+var _ Fetcher = (*rss.Fetcher)(nil)
+
 // Init loads feeds from cache for an instant first paint, then refreshes them
 // over the network, so the UI never blocks on startup.
 func (m Model) Init() tea.Cmd {
 	return tea.Batch(
 		tea.SetWindowTitle("izrss"),
-		tea.Sequence(m.loadCachedFeeds(), m.refreshAll()),
+		tea.Sequence(m.loadCachedFeeds(), m.refreshAll(false)),
 	)
 }
 
 // NewModel creates a new model with sensible defaults
-func NewModel(cfg *config.Config, db *storage.DB, fetcher *rss.Fetcher) *Model {
+func NewModel(cfg *config.Config, db *storage.DB, fetcher Fetcher) *Model {
 	styles := NewStyles(cfg)
 
 	t := table.New(table.WithFocused(true))
@@ -65,19 +107,36 @@ func NewModel(cfg *config.Config, db *storage.DB, fetcher *rss.Fetcher) *Model {
 		glamStyle = "dark"
 	}
 
+	imageProtocol, err := images.ParseProtocol(cfg.Reader.ImageProtocol)
+	if err != nil {
+		log.Printf("%v, using %s", err, images.HalfBlock)
+		imageProtocol = images.HalfBlock
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
 	return &Model{
-		context:   context{},
+		context:   viewState{},
 		viewport:  viewport.Model{},
 		table:     t,
 		ready:     false,
 		help:      NewHelp(styles),
 		keys:      defaultKeyMap,
+		actions:   newActions(cfg.Commands.Actions),
+		searches:  loadSearches(cfg, db),
 		filter:    f,
 		cfg:       cfg,
 		db:        db,
 		fetcher:   fetcher,
 		styles:    styles,
 		glamStyle: glamStyle,
+		ctx:       ctx,
+		cancel:    cancel,
+		refresh:   &refresher{},
+
+		imageProtocol: imageProtocol,
+		term:          os.Stdout,
+		kitty:         &kittyImages{ids: make(map[string]uint32)},
 	}
 }
 
@@ -92,19 +151,77 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case tea.WindowSizeMsg:
 		m = m.handleWindowSize(msg)
 	case tea.KeyMsg:
+		owned := m.ownsKey(msg)
 		m, cmd = m.handleKeys(msg)
 		cmds = append(cmds, cmd)
+		if owned {
+			// Still redraw the list, without the key
+			m, cmd = m.updateViewport(nil)
+			return m, tea.Batch(append(cmds, cmd)...)
+		}
 	case feedsRefreshedMsg:
 		m.context.feeds = msg.feeds
+		m.context.copies = nil
 		m.reloadList()
 	case feedRefreshedMsg:
 		if msg.id >= 0 && msg.id < len(m.context.feeds) {
 			m.context.feeds[msg.id].Posts = msg.posts
+			m.context.feeds.Reindex()
+			m.context.copies = nil
 			if err := m.context.feeds.ReadTracking(m.db); err != nil {
 				log.Printf("error reading tracking: %v", err)
 			}
 		}
 		m.reloadList()
+	case clearStatusMsg:
+		if msg.id == m.statusID {
+			m.status = ""
+		}
+	case imagesLoadedMsg:
+		post := m.context.post
+		if m.context.curr == "reader" && post.FeedID == msg.feedID && post.UUID == msg.uuid {
+			for src, img := range msg.images {
+				m.context.images[src] = img
+			}
+			cmds = append(cmds, m.renderReader())
+		}
+	case downloadProgressMsg:
+		cmds = append(cmds, m.updateDownload(msg))
+	case downloadDoneMsg:
+		cmds = append(cmds, m.finishDownload(msg))
+	case exportDoneMsg:
+		if msg.err != nil {
+			log.Printf("error exporting posts: %v", msg.err)
+			cmds = append(cmds, m.setStatus("Could not export: "+msg.err.Error()))
+		} else {
+			cmds = append(cmds, m.setStatus("Exported to "+msg.path))
+		}
+	case externalDoneMsg:
+		if err := os.Remove(msg.path); err != nil {
+			log.Printf("could not remove %s: %v", msg.path, err)
+		}
+		if msg.err != nil {
+			log.Printf("error opening post: %v", msg.err)
+			cmds = append(cmds, m.setStatus("Could not open the post"))
+		}
+	case actionDoneMsg:
+		if msg.err != nil {
+			log.Printf("error running %s: %v", msg.name, msg.err)
+			cmds = append(cmds, m.setStatus(fmt.Sprintf("%s exited with an error", msg.name)))
+		}
+	case articleLoadedMsg:
+		post := m.context.post
+		if m.context.curr == "reader" && post.FeedID == msg.feedID && post.UUID == msg.uuid {
+			if msg.err != nil {
+				log.Printf("could not load full article: %v", msg.err)
+				m.context.fullArticle = false
+				cmds = append(cmds, m.setStatus("Could not load the full article"))
+			} else {
+				m.context.article = msg.content
+				m.viewport.SetYOffset(0)
+				cmds = append(cmds, m.renderReader(), m.setStatus("Showing the full article"))
+			}
+		}
 	}
 
 	m, cmd = m.updateViewport(msg)
@@ -143,25 +260,25 @@ func (m Model) handleWindowSize(msg tea.WindowSizeMsg) Model {
 }
 
 func (m *Model) setupGlamour(width int) {
-	var glamWidth glamour.TermRendererOption
 	switch size := m.cfg.Reader.Size.(type) {
 	case string:
 		switch size {
 		case "full", "fullscreen":
-			glamWidth = glamour.WithWordWrap(width)
+			m.glamWidth = width
 		case "most":
-			glamWidth = glamour.WithWordWrap(int(float64(width) * 0.75))
+			m.glamWidth = int(float64(width) * 0.75)
 		case "recomended":
-			glamWidth = glamour.WithWordWrap(80)
+			m.glamWidth = 80
 		default:
-			glamWidth = glamour.WithWordWrap(80)
+			m.glamWidth = 80
 		}
 	case int64:
-		glamWidth = glamour.WithWordWrap(int(size))
+		m.glamWidth = int(size)
 	default:
 		log.Printf("invalid reader size: %v, using default", m.cfg.Reader.Size)
-		glamWidth = glamour.WithWordWrap(80)
+		m.glamWidth = 80
 	}
+	glamWidth := glamour.WithWordWrap(m.glamWidth)
 
 	var glamTheme glamour.TermRendererOption
 	switch m.cfg.Reader.Theme {
@@ -188,14 +305,19 @@ func (m Model) updateViewport(msg tea.Msg) (Model, tea.Cmd) {
 
 	m.help, cmd = m.help.Update(msg)
 	cmds = append(cmds, cmd)
+	cursor := m.table.Cursor()
 	m.table, cmd = m.table.Update(msg)
 	cmds = append(cmds, cmd)
 
+	if m.cfg.List.MarkReadOnScroll {
+		m.markScrolledPast(cursor)
+	}
+
 	if m.context.curr != "reader" && m.context.curr != "search" {
 		view := lipgloss.JoinVertical(
 			lipgloss.Top,
 			m.table.View(),
-			m.help.View(m.keys, m),
+			m.footer(),
 		)
 		m.viewport.SetContent(view)
 	} else if m.context.curr == "search" {
@@ -206,7 +328,7 @@ func (m Model) updateViewport(msg tea.Msg) (Model, tea.Cmd) {
 			lipgloss.Top,
 			m.filter.View(),
 			m.table.View(),
-			m.help.View(m.keys, m),
+			m.footer(),
 		)
 
 		m.viewport.SetContent(view)
@@ -214,17 +336,43 @@ func (m Model) updateViewport(msg tea.Msg) (Model, tea.Cmd) {
 
 	// Auto-mark post as read when scrolled past the threshold
 	if m.context.curr == "reader" && m.viewport.ScrollPercent() >= m.cfg.Reader.ReadThreshold {
-		post := &m.context.feeds[m.context.feed.ID].Posts[m.context.post.ID]
-		if !post.Read {
-			rss.MarkRead(m.context.feeds, m.context.feed.ID, m.context.post.ID)
-			if err := m.context.feeds.WriteTracking(m.db); err != nil {
+		post := m.context.post
+		if !post.Read && post.FeedID < len(m.context.feeds) && post.ID < len(m.context.feeds[post.FeedID].Posts) {
+			rss.MarkRead(m.context.feeds, post.FeedID, post.ID)
+			m.context.post.Read = true
+			if err := m.context.feeds.WritePosts(m.db, []rss.Post{post}); err != nil {
 				log.Printf("error writing tracking: %v", err)
 			}
 		}
 	}
 
-	m.viewport, cmd = m.viewport.Update(msg)
-	cmds = append(cmds, cmd)
+	// The link list takes over the reader's movement keys while it is open.
+	if !m.context.showLinks || m.context.curr != "reader" {
+		offset := m.viewport.YOffset
+		m.viewport, cmd = m.viewport.Update(msg)
+		cmds = append(cmds, cmd)
+		if m.context.curr == "reader" && m.viewport.YOffset != offset {
+			m.clearImages(false)
+		}
+	}
 
 	return m, tea.Batch(cmds...)
 }
+
+// markScrolledPast marks the posts the cursor moved down past since prev as
+// read. Search results are skipped, as they are not a list the user reads
+// through in order.
+func (m *Model) markScrolledPast(prev int) {
+	if (m.context.curr != "content" && m.context.curr != "mixed") || m.context.feed.ID == searchResultsID {
+		return
+	}
+
+	cursor := m.table.Cursor()
+	if cursor <= prev || cursor > len(m.context.feed.Posts) {
+		return
+	}
+
+	if m.setPostsRead(m.context.feed.Posts[prev:cursor], true) != nil {
+		m.reloadList()
+	}
+}
@@ -0,0 +1,465 @@
+package ui
+
+import (
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/bubbles/table"
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/isabelroses/izrss/internal/config"
+	"github.com/isabelroses/izrss/internal/rss"
+	"github.com/isabelroses/izrss/internal/storage"
+)
+
+func newTestModel(t *testing.T, feeds rss.Feeds) *Model {
+	t.Helper()
+
+	db, err := storage.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	feeds.Reindex()
+
+	m := NewModel(config.Default(), db, nil)
+	m.table = table.New(table.WithFocused(true), table.WithWidth(100))
+	m.context.feeds = feeds
+	m.ready = true
+	m.term = io.Discard
+	return m
+}
+
+func testFeeds() rss.Feeds {
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	return rss.Feeds{
+		{Title: "Alpha", URL: "https://alpha.example/feed", Posts: []rss.Post{
+			{UUID: "a1", Title: "old alpha", Published: base},
+		}},
+		{Title: "Beta", URL: "https://beta.example/feed", Posts: []rss.Post{
+			{UUID: "b1", Title: "new beta", Published: base.Add(48 * time.Hour)},
+			{UUID: "b2", Title: "mid beta", Published: base.Add(24 * time.Hour)},
+		}},
+	}
+}
+
+func TestLoadMixed_ShowsSourceFeed(t *testing.T) {
+	m := newTestModel(t, testFeeds())
+	m.loadMixed()
+
+	rows := m.table.Rows()
+	if len(rows) != 3 {
+		t.Fatalf("Expected 3 rows, got %d", len(rows))
+	}
+	if rows[0][2] != "Beta" || rows[0][3] != "new beta" {
+		t.Errorf("Expected newest post from Beta first, got %v", rows[0])
+	}
+	if rows[2][2] != "Alpha" {
+		t.Errorf("Expected oldest post from Alpha last, got %v", rows[2])
+	}
+}
+
+func TestMixedToggleRead_TargetsSourcePost(t *testing.T) {
+	m := newTestModel(t, testFeeds())
+	m.loadMixed()
+	m.table.SetCursor(1) // "mid beta", the second post of the second feed
+
+	updated, _ := m.handleKeys(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("x")})
+
+	feeds := updated.context.feeds
+	if !feeds[1].Posts[1].Read {
+		t.Error("Expected the selected post to be marked read")
+	}
+	if feeds[0].Posts[0].Read || feeds[1].Posts[0].Read {
+		t.Error("Expected no other post to change")
+	}
+}
+
+func TestUndo_RestoresMarkAllRead(t *testing.T) {
+	feeds := testFeeds()
+	feeds[1].Posts[0].Read = true
+	m := newTestModel(t, feeds)
+	m.loadContent(1)
+
+	updated, _ := m.handleKeys(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("X")})
+	for _, post := range updated.context.feeds[1].Posts {
+		if !post.Read {
+			t.Fatal("Expected every post to be read after mark all as read")
+		}
+	}
+
+	updated, cmd := updated.handleKeys(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("u")})
+	if cmd == nil {
+		t.Error("Expected a command to clear the status message")
+	}
+	if updated.status != "Undid mark all as read" {
+		t.Errorf("Unexpected status %q", updated.status)
+	}
+
+	posts := updated.context.feeds[1].Posts
+	if !posts[0].Read {
+		t.Error("Expected the post that was already read to stay read")
+	}
+	if posts[1].Read {
+		t.Error("Expected the undone post to be unread again")
+	}
+	if len(updated.undo) != 0 {
+		t.Errorf("Expected an empty undo stack, got %d entries", len(updated.undo))
+	}
+}
+
+func TestStar_ToggleAndUndo(t *testing.T) {
+	m := newTestModel(t, testFeeds())
+	m.loadContent(1)
+
+	updated, _ := m.handleKeys(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("s")})
+	if !updated.context.feeds[1].Posts[0].Starred {
+		t.Fatal("Expected the selected post to be starred")
+	}
+	if row := updated.table.Rows()[0]; !strings.HasPrefix(row[2], starSymbol) {
+		t.Errorf("Expected the starred post to be marked in the list, got %v", row)
+	}
+
+	stars, err := updated.db.LoadPostStars()
+	if err != nil {
+		t.Fatalf("LoadPostStars failed: %v", err)
+	}
+	if !stars[storage.PostKey{FeedURL: "https://beta.example/feed", UUID: "b1"}] {
+		t.Errorf("Expected the star to be saved, got %v", stars)
+	}
+
+	updated, _ = updated.handleKeys(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("u")})
+	if updated.status != "Undid toggle star" {
+		t.Errorf("Unexpected status %q", updated.status)
+	}
+	if updated.context.feeds[1].Posts[0].Starred {
+		t.Error("Expected undo to unstar the post")
+	}
+}
+
+// update sends msg through the model's Update, as the program would
+func update(t *testing.T, m *Model, msg tea.Msg) {
+	t.Helper()
+	updated, _ := m.Update(msg)
+	*m = updated.(Model)
+}
+
+func TestUndo_KeepsCursor(t *testing.T) {
+	feed := rss.Feed{Title: "Long", URL: "https://long.example/feed"}
+	for i := range 30 {
+		feed.Posts = append(feed.Posts, rss.Post{UUID: strconv.Itoa(i), Title: "post"})
+	}
+	m := newTestModel(t, rss.Feeds{feed})
+	m.table.SetHeight(10)
+	m.loadContent(0)
+	m.table.SetCursor(20)
+
+	update(t, m, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("x")})
+	update(t, m, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("u")})
+	if m.context.feeds[0].Posts[20].Read {
+		t.Error("Expected undo to mark the post unread again")
+	}
+	if m.table.Cursor() != 20 {
+		t.Errorf("Expected the cursor to stay on row 20, got %d", m.table.Cursor())
+	}
+}
+
+func TestUndo_NothingToUndo(t *testing.T) {
+	m := newTestModel(t, testFeeds())
+	m.loadHome()
+
+	updated, _ := m.handleKeys(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("u")})
+	if updated.status != "Nothing to undo" {
+		t.Errorf("Unexpected status %q", updated.status)
+	}
+}
+
+func TestMarkAbove_MarksPostsBeforeCursor(t *testing.T) {
+	m := newTestModel(t, testFeeds())
+	m.loadMixed()
+	m.table.SetCursor(2)
+
+	updated, _ := m.handleKeys(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("a")})
+
+	feeds := updated.context.feeds
+	if !feeds[1].Posts[0].Read || !feeds[1].Posts[1].Read {
+		t.Error("Expected both posts above the cursor to be read")
+	}
+	if feeds[0].Posts[0].Read {
+		t.Error("Expected the post under the cursor to stay unread")
+	}
+}
+
+func TestMarkAbove_EmptyList(t *testing.T) {
+	feeds := testFeeds()
+	feeds = append(feeds, rss.Feed{Title: "Empty", URL: "https://empty.example/feed"})
+	m := newTestModel(t, feeds)
+	m.loadContent(2)
+
+	updated, _ := m.handleKeys(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("a")})
+	if len(updated.undo) != 0 {
+		t.Errorf("Expected nothing to be marked, got %d undo entries", len(updated.undo))
+	}
+
+	updated.context.feeds = nil
+	updated.loadMixed()
+	updated, _ = updated.handleKeys(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("a")})
+	if len(updated.undo) != 0 {
+		t.Errorf("Expected nothing to be marked, got %d undo entries", len(updated.undo))
+	}
+}
+
+func TestMarkOlder_MarksAcrossFeeds(t *testing.T) {
+	feeds := testFeeds()
+	feeds[1].Posts[0].Published = time.Now()
+	m := newTestModel(t, feeds)
+	m.loadHome()
+
+	updated, _ := m.handleKeys(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("A")})
+
+	if !updated.context.feeds[0].Posts[0].Read || !updated.context.feeds[1].Posts[1].Read {
+		t.Error("Expected old posts in every feed to be read")
+	}
+	if updated.context.feeds[1].Posts[0].Read {
+		t.Error("Expected the recent post to stay unread")
+	}
+	if updated.status != "Marked 2 posts older than 30 days as read" {
+		t.Errorf("Unexpected status %q", updated.status)
+	}
+}
+
+func TestMarkReadOnScroll(t *testing.T) {
+	m := newTestModel(t, testFeeds())
+	m.cfg.List.MarkReadOnScroll = true
+	m.loadContent(1)
+
+	updated, _ := m.updateViewport(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("j")})
+
+	posts := updated.context.feeds[1].Posts
+	if !posts[0].Read {
+		t.Error("Expected the post scrolled past to be read")
+	}
+	if posts[1].Read {
+		t.Error("Expected the post under the cursor to stay unread")
+	}
+}
+
+func TestLoadMixed_CollapsesDuplicates(t *testing.T) {
+	feeds := testFeeds()
+	feeds[0].Posts[0].Link = "https://beta.example/new"
+	feeds[1].Posts[0].Link = "https://beta.example/new/"
+	m := newTestModel(t, feeds)
+	m.loadMixed()
+
+	rows := m.table.Rows()
+	if len(rows) != 2 {
+		t.Fatalf("Expected the shared post to be listed once, got %d rows", len(rows))
+	}
+	if rows[0][2] != "Beta +1" {
+		t.Errorf("Expected the newest copy with a count of the others, got %v", rows[0])
+	}
+
+	m.table.SetCursor(0)
+	updated, _ := m.handleKeys(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("x")})
+	if !updated.context.feeds[0].Posts[0].Read || !updated.context.feeds[1].Posts[0].Read {
+		t.Error("Expected every copy to be marked read")
+	}
+
+	updated, _ = updated.handleKeys(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("u")})
+	if updated.context.feeds[0].Posts[0].Read || updated.context.feeds[1].Posts[0].Read {
+		t.Error("Expected undo to restore every copy")
+	}
+}
+
+func TestCopies_FoundOncePerLoad(t *testing.T) {
+	feeds := testFeeds()
+	feeds[0].Posts[0].Link = "https://beta.example/new"
+	feeds[1].Posts[0].Link = "https://beta.example/new/"
+	m := newTestModel(t, feeds)
+	m.loadMixed()
+
+	copies := m.context.copies
+	update(t, m, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("x")})
+	update(t, m, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("x")})
+	if m.context.copies != copies {
+		t.Error("Expected marking posts to reuse the copies found on load")
+	}
+
+	// A refresh can change which posts are copies
+	refreshed := testFeeds()
+	refreshed.Reindex()
+	update(t, m, feedsRefreshedMsg{feeds: refreshed})
+	if m.context.copies == copies || len(m.table.Rows()) != 3 {
+		t.Errorf("Expected the copies to be found again after a refresh, got %d rows", len(m.table.Rows()))
+	}
+}
+
+func TestSavedSearch_ListedOnHome(t *testing.T) {
+	m := newTestModel(t, testFeeds())
+	if err := m.db.SaveSearch("unread beta", "feed:beta is:unread"); err != nil {
+		t.Fatalf("SaveSearch failed: %v", err)
+	}
+	m.searches = loadSearches(m.cfg, m.db)
+	m.loadHome()
+
+	rows := m.table.Rows()
+	if len(rows) != 3 || rows[2][0] != "2/2" || !strings.Contains(rows[2][1], "unread beta") {
+		t.Fatalf("Expected the search after the feeds with 2 unread posts, got %v", rows)
+	}
+
+	// Reading a post in its feed updates the search's count
+	m.markPosts("toggle read", []rss.Post{m.context.feeds[1].Posts[0]}, true)
+	m.loadHome()
+	if got := m.table.Rows()[2][0]; got != "1/1" {
+		t.Errorf("Expected 1/1 after reading a post, got %s", got)
+	}
+
+	m.table.SetCursor(2)
+	updated, _ := m.handleKeys(tea.KeyMsg{Type: tea.KeyEnter})
+	if updated.context.curr != "content" || len(updated.table.Rows()) != 1 {
+		t.Fatalf("Expected the search's one post listed, got %v", updated.table.Rows())
+	}
+
+	// The post read from the list stays listed until the list is left
+	updated, _ = updated.handleKeys(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("x")})
+	if rows := updated.table.Rows(); len(rows) != 1 || rows[0][0] != rss.ReadSymbol(true) {
+		t.Errorf("Expected the read post to stay listed, got %v", rows)
+	}
+}
+
+func TestSearch_FromMixedView(t *testing.T) {
+	m := newTestModel(t, testFeeds())
+	m.loadMixed()
+
+	press := func(keys ...tea.KeyMsg) {
+		for _, msg := range keys {
+			updated, _ := m.handleKeys(msg)
+			*m = updated
+		}
+	}
+	runes := func(s string) tea.KeyMsg { return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(s)} }
+
+	press(runes("/"))
+	m.filter.SetValue("feed:beta")
+	press(tea.KeyMsg{Type: tea.KeyEnter})
+	if len(m.context.feed.Posts) != 2 {
+		t.Fatalf("Expected the two posts from beta, got %d", len(m.context.feed.Posts))
+	}
+
+	// Toggling a post lists the same results again, with the post read
+	press(runes("x"))
+	if m.context.curr != "content" || len(m.table.Rows()) != 2 || len(m.context.feed.Posts) != 2 {
+		t.Fatalf("Expected the search results to stay listed, got %d rows on %q", len(m.table.Rows()), m.context.curr)
+	}
+	if !m.context.feeds[1].Posts[0].Read {
+		t.Error("Expected the toggled post to be read")
+	}
+
+	// Back from the reader returns to the results
+	press(tea.KeyMsg{Type: tea.KeyEnter}, runes("h"))
+	if m.context.curr != "content" || m.context.feed.ID != searchResultsID || len(m.table.Rows()) != 2 {
+		t.Errorf("Expected to be back on the search results, got %q with %d rows", m.context.curr, len(m.table.Rows()))
+	}
+}
+
+func TestSearch_PhraseInContent(t *testing.T) {
+	feeds := testFeeds()
+	feeds[0].Posts[0].Content = "Notes on Error Handling"
+	feeds[1].Posts[0].Content = "handling errors"
+	m := newTestModel(t, feeds)
+	m.loadHome()
+
+	search := func(query string) []string {
+		m.loadSearch()
+		m.filter.SetValue(query)
+		updated, _ := m.handleKeys(tea.KeyMsg{Type: tea.KeyEnter})
+		*m = updated
+		var got []string
+		for _, post := range m.context.feed.Posts {
+			got = append(got, post.UUID)
+		}
+		return got
+	}
+
+	// The whole query is matched in the content, ignoring case
+	if got := search("error handling"); len(got) != 1 || got[0] != "a1" {
+		t.Errorf("Expected the phrase to match only a1, got %v", got)
+	}
+	if got := search(`"ERROR HANDLING"`); len(got) != 1 || got[0] != "a1" {
+		t.Errorf("Expected the quoted phrase to match only a1, got %v", got)
+	}
+	// A title isn't searched without filters
+	if got := search("beta"); len(got) != 0 {
+		t.Errorf("Expected titles not to match, got %v", got)
+	}
+
+	// A filter that can't be read is searched for as text
+	feeds[1].Posts[1].Content = "see is:foo"
+	if got := search("is:foo"); len(got) != 1 || got[0] != "b2" {
+		t.Errorf("Expected is:foo to be searched as text, got %v", got)
+	}
+	if !strings.Contains(m.status, "searching for the text") {
+		t.Errorf("Expected a status about the unknown filter, got %q", m.status)
+	}
+}
+
+func TestSavedSearch_SaveAndDelete(t *testing.T) {
+	m := newTestModel(t, testFeeds())
+	m.loadHome()
+	m.loadSearch()
+	m.filter.SetValue("beta")
+
+	updated, _ := m.handleKeys(tea.KeyMsg{Type: tea.KeyCtrlS})
+	if updated.context.saving != "beta" {
+		t.Fatalf("Expected to be naming the search, saving %q", updated.context.saving)
+	}
+	updated.filter.SetValue("betas")
+	updated, _ = updated.handleKeys(tea.KeyMsg{Type: tea.KeyEnter})
+
+	if updated.context.curr != "home" || len(updated.searches) != 1 || updated.searches[0].Query != "beta" {
+		t.Fatalf("Expected the saved search on home, got %+v", updated.searches)
+	}
+	if updated.table.Cursor() != 2 {
+		t.Errorf("Expected the cursor on the new search, got row %d", updated.table.Cursor())
+	}
+
+	updated, _ = updated.handleKeys(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("D")})
+	if len(updated.searches) != 0 || len(updated.table.Rows()) != 2 {
+		t.Errorf("Expected the search to be deleted, got %+v", updated.searches)
+	}
+	if saved, err := updated.db.LoadSearches(); err != nil || len(saved) != 0 {
+		t.Errorf("Expected no saved searches left, got %v (%v)", saved, err)
+	}
+}
+
+func TestFullHelp_SaysWhatExportCovers(t *testing.T) {
+	m := newTestModel(t, testFeeds())
+	descs := func() []string {
+		var got []string
+		for _, column := range m.keys.FullHelp(*m) {
+			for _, b := range column {
+				if b.Help().Key == "E" {
+					got = append(got, b.Help().Desc)
+				}
+			}
+		}
+		return got
+	}
+
+	m.loadHome()
+	if got := descs(); len(got) != 1 || got[0] != "export feed" {
+		t.Errorf("Expected the home view to export a feed, got %v", got)
+	}
+	m.loadContent(1)
+	if got := descs(); len(got) != 1 || got[0] != "export post" {
+		t.Errorf("Expected a post list to export a post, got %v", got)
+	}
+	if m.keys.Export.Help().Desc != "export" {
+		t.Errorf("Expected the shared binding to be left as it was, got %q", m.keys.Export.Help().Desc)
+	}
+}
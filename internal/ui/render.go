@@ -1,5 +1,226 @@
 package ui
 
-import tomd "github.com/JohannesKaufmann/html-to-markdown"
+import (
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"net/url"
+	"regexp"
+	"strings"
 
-var htmlToMarkdown = tomd.NewConverter("", true, nil)
+	"github.com/PuerkitoBio/goquery"
+	"github.com/charmbracelet/lipgloss"
+
+	"github.com/isabelroses/izrss/internal/export"
+	"github.com/isabelroses/izrss/internal/images"
+	"github.com/isabelroses/izrss/internal/rss"
+)
+
+// imagePattern matches a markdown image, along with a link wrapped around it,
+// capturing the alt text and source.
+var imagePattern = regexp.MustCompile(`\[?!\[([^\]]*)\]\(([^)\s]+)[^)]*\)(?:\]\([^)]*\))?`)
+
+// imageIndent lines images up with glamour's document margin.
+const imageIndent = "  "
+
+// renderPost renders a post for the reader. Images that have been loaded are
+// drawn inline, the rest show their alt text; it also returns the sources of
+// images that have not been fetched yet.
+func (m *Model) renderPost(post rss.Post) (string, []string) {
+	md, err := export.ToMarkdown(post.Content)
+	if err != nil {
+		log.Printf("%v", err)
+		md = post.Content
+	}
+
+	if !m.cfg.Reader.Images {
+		return m.renderMarkdown(md), nil
+	}
+
+	base, _ := url.Parse(post.Link)
+	cols := max(m.glamWidth-2*len(imageIndent), 1)
+	rows := max(m.viewport.Height-2, 4)
+
+	var (
+		b       strings.Builder
+		missing []string
+		last    int
+	)
+	for _, loc := range imagePattern.FindAllStringSubmatchIndex(md, -1) {
+		b.WriteString(m.renderMarkdown(md[last:loc[0]]))
+		last = loc[1]
+
+		alt, src := md[loc[2]:loc[3]], md[loc[4]:loc[5]]
+		if ref, err := url.Parse(src); err == nil && base != nil {
+			src = base.ResolveReference(ref).String()
+		}
+
+		img, fetched := m.context.images[src]
+		if !fetched {
+			missing = append(missing, src)
+		}
+		if img == nil {
+			if alt == "" {
+				alt = "image"
+			}
+			b.WriteString(imageIndent + m.styles.Help.Render("["+alt+"]") + "\n")
+			continue
+		}
+
+		drawn := m.drawImage(src, img, cols, rows)
+		b.WriteString("\n" + indent(drawn) + "\n")
+	}
+	b.WriteString(m.renderMarkdown(md[last:]))
+
+	return b.String(), missing
+}
+
+// wordsPerMinute is the reading speed reading time estimates assume.
+const wordsPerMinute = 200
+
+// renderHeader renders the block of post metadata shown above a post: its
+// feed, authors, dates, categories, reading time, link and media. Lines without
+// anything to show are left out.
+func (m *Model) renderHeader(post rss.Post) string {
+	width := max(m.glamWidth-2*len(imageIndent), 1)
+	title := lipgloss.NewStyle().Bold(true).Width(width)
+	meta := m.styles.Help.Width(width)
+
+	var byline []string
+	if post.FeedTitle != "" {
+		byline = append(byline, post.FeedTitle)
+	}
+	if len(post.Authors) > 0 {
+		byline = append(byline, "by "+strings.Join(post.Authors, ", "))
+	}
+
+	var dates []string
+	if !post.Published.IsZero() {
+		dates = append(dates, "Published "+post.Published.Format(m.cfg.DateFormat))
+	}
+	if !post.Updated.IsZero() && !post.Updated.Equal(post.Published) {
+		dates = append(dates, "Updated "+post.Updated.Format(m.cfg.DateFormat))
+	}
+	if minutes := readingTime(post.Content); minutes > 0 {
+		dates = append(dates, fmt.Sprintf("%d min read", minutes))
+	}
+
+	lines := []string{title.Render(post.Title)}
+	for _, line := range append([]string{
+		strings.Join(byline, " · "),
+		strings.Join(dates, " · "),
+		tagList(post.Categories),
+		post.Link,
+	}, enclosureLines(post)...) {
+		if line != "" {
+			lines = append(lines, meta.Render(line))
+		}
+	}
+
+	return "\n" + indent(strings.Join(lines, "\n")) + "\n"
+}
+
+// readingTime estimates the minutes it takes to read a post's HTML, rounding
+// up so that any text takes at least a minute.
+func readingTime(content string) int {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(content))
+	if err != nil {
+		return 0
+	}
+	words := len(strings.Fields(doc.Text()))
+	return (words + wordsPerMinute - 1) / wordsPerMinute
+}
+
+func tagList(categories []string) string {
+	tags := make([]string, 0, len(categories))
+	for _, c := range categories {
+		if c = strings.TrimSpace(c); c != "" {
+			tags = append(tags, "#"+c)
+		}
+	}
+	return strings.Join(tags, " ")
+}
+
+// renderMarkdown renders a markdown fragment with glamour, skipping blank ones
+// so the gaps between images don't pile up empty margins.
+func (m *Model) renderMarkdown(md string) string {
+	if strings.TrimSpace(md) == "" {
+		return ""
+	}
+
+	out, err := m.glam.Render(md)
+	if err != nil {
+		log.Printf("could not render markdown: %v", err)
+		return md
+	}
+	return out
+}
+
+func indent(s string) string {
+	return imageIndent + strings.ReplaceAll(s, "\n", "\n"+imageIndent)
+}
+
+// kittyImages tracks the images sent to the terminal with the kitty protocol
+type kittyImages struct {
+	// ids holds the id each image was sent under, by source
+	ids map[string]uint32
+	// placement numbers each time an image is drawn, so a redrawn line always
+	// differs from what was on screen and the terminal is sent it again
+	placement uint32
+}
+
+// drawImage draws an image for the reader. With the kitty protocol an image is
+// sent to the terminal the first time it is drawn and only placed after that.
+func (m *Model) drawImage(src string, img image.Image, cols, rows int) string {
+	if m.imageProtocol != images.Kitty {
+		return images.Render(img, m.imageProtocol, cols, rows)
+	}
+
+	id, sent := m.kitty.ids[src]
+	if !sent {
+		id = uint32(len(m.kitty.ids) + 1)
+		m.kitty.ids[src] = id
+		m.writeTerm(images.KittyTransmit(img, id))
+	}
+	m.kitty.placement++
+	return images.KittyPlace(img, id, m.kitty.placement, cols, rows)
+}
+
+// clearImages takes the kitty images off the screen before the reader
+// scrolls or redraws, so none are left where their lines used to be. free
+// also drops them from the terminal, for when the reader closes.
+func (m *Model) clearImages(free bool) {
+	if m.imageProtocol != images.Kitty || len(m.kitty.ids) == 0 {
+		return
+	}
+	m.writeTerm(images.KittyClear(free))
+	if free {
+		clear(m.kitty.ids)
+	}
+}
+
+// writeTerm writes escapes straight to the terminal, outside the view
+func (m *Model) writeTerm(s string) {
+	if _, err := io.WriteString(m.term, s); err != nil {
+		log.Printf("error writing to the terminal: %v", err)
+	}
+}
+
+// decodeImages turns fetched image data into images, leaving a nil entry for
+// any that failed so they are not fetched again for the same post.
+func decodeImages(data map[string][]byte) map[string]image.Image {
+	decoded := make(map[string]image.Image, len(data))
+	for src, d := range data {
+		if d == nil {
+			decoded[src] = nil
+			continue
+		}
+		img, err := images.Decode(d)
+		if err != nil {
+			log.Printf("could not decode image %s: %v", src, err)
+		}
+		decoded[src] = img
+	}
+	return decoded
+}
@@ -0,0 +1,176 @@
+package ui
+
+import (
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/isabelroses/izrss/internal/images"
+	"github.com/isabelroses/izrss/internal/rss"
+)
+
+func TestRenderPost_Images(t *testing.T) {
+	m := newTestModel(t, rss.Feeds{})
+	m.setupGlamour(80)
+	m.viewport.Height = 40
+	m.imageProtocol = images.HalfBlock
+	m.context.images = make(map[string]image.Image)
+
+	post := rss.Post{
+		Link:    "https://example.com/posts/1",
+		Content: `<p>Before</p><img src="/a.png" alt="a chart"><p>After</p>`,
+	}
+
+	out, missing := m.renderPost(post)
+	if len(missing) != 1 || missing[0] != "https://example.com/a.png" {
+		t.Fatalf("Expected the resolved image source to be missing, got %v", missing)
+	}
+	if !strings.Contains(out, "[a chart]") {
+		t.Errorf("Expected alt text while the image loads, got %q", out)
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, 20, 20))
+	img.SetRGBA(0, 0, color.RGBA{R: 255, A: 255})
+	m.context.images["https://example.com/a.png"] = img
+
+	out, missing = m.renderPost(post)
+	if len(missing) != 0 {
+		t.Errorf("Expected no missing images, got %v", missing)
+	}
+	if !strings.Contains(out, "▀") || strings.Contains(out, "[a chart]") {
+		t.Errorf("Expected the image to be drawn, got %q", out)
+	}
+	if !strings.Contains(out, "Before") || !strings.Contains(out, "After") {
+		t.Errorf("Expected the surrounding text, got %q", out)
+	}
+}
+
+func TestRenderPost_KittySendsImagesOnce(t *testing.T) {
+	m := newTestModel(t, rss.Feeds{})
+	m.setupGlamour(80)
+	m.viewport = viewport.New(80, 10)
+	m.imageProtocol = images.Kitty
+	var term strings.Builder
+	m.term = &term
+
+	src := "https://example.com/a.png"
+	m.context.images = map[string]image.Image{src: image.NewRGBA(image.Rect(0, 0, 20, 20))}
+	m.context.post = rss.Post{Content: `<img src="` + src + `">` + strings.Repeat("<p>line</p>", 20)}
+
+	m.renderReader()
+	m.renderReader()
+	if got := strings.Count(term.String(), "a=t,"); got != 1 {
+		t.Errorf("Expected the image to be sent once, got %d", got)
+	}
+	if !strings.Contains(m.viewport.View(), "a=p,") {
+		t.Error("Expected the view to place the image")
+	}
+
+	term.Reset()
+	m.context.curr = "reader"
+	m.updateViewport(tea.KeyMsg{Type: tea.KeyDown})
+	if term.String() != images.KittyClear(false) {
+		t.Errorf("Expected scrolling to clear the placed images, got %q", term.String())
+	}
+
+	term.Reset()
+	m.swapPage("content")
+	if term.String() != images.KittyClear(true) || len(m.kitty.ids) != 0 {
+		t.Errorf("Expected leaving the reader to free the images, got %q", term.String())
+	}
+}
+
+func TestRenderPost_ImagesDisabled(t *testing.T) {
+	m := newTestModel(t, rss.Feeds{})
+	m.cfg.Reader.Images = false
+	m.setupGlamour(80)
+
+	_, missing := m.renderPost(rss.Post{Content: `<img src="https://example.com/a.png">`})
+	if len(missing) != 0 {
+		t.Errorf("Expected no images to be fetched, got %v", missing)
+	}
+}
+
+func TestArticleLoaded_ReplacesContent(t *testing.T) {
+	m := newTestModel(t, testFeeds())
+	m.setupGlamour(80)
+	m.viewport = viewport.New(80, 20)
+	m.loadContent(0)
+	m.loadReader()
+	m.context.fullArticle = true
+
+	updated, _ := m.Update(articleLoadedMsg{
+		content: "<p>The whole story</p>",
+		uuid:    m.context.post.UUID,
+		feedID:  m.context.post.FeedID,
+	})
+
+	view := updated.(Model).viewport.View()
+	if !strings.Contains(view, "The whole") || !strings.Contains(view, "story") {
+		t.Errorf("Expected the reader to show the full article, got %q", view)
+	}
+}
+
+func TestFullArticle_KeepsOffset(t *testing.T) {
+	feeds := testFeeds()
+	feeds[0].Posts[0].Content = strings.Repeat("<p>feed text</p>", 100)
+	m := newTestModel(t, feeds)
+	m.setupGlamour(80)
+	m.viewport = viewport.New(80, 20)
+	m.loadContent(0)
+	m.loadReader()
+	m.context.article = strings.Repeat("<p>full article</p>", 100)
+
+	for range 3 {
+		update(t, m, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("f")})
+		if m.viewport.YOffset != 0 {
+			t.Fatalf("Expected switching to the full article to stay at the top, got offset %d", m.viewport.YOffset)
+		}
+	}
+	if m.context.feeds[0].Posts[0].Read {
+		t.Error("Expected switching to the full article not to mark the post read")
+	}
+}
+
+func TestRenderHeader(t *testing.T) {
+	m := newTestModel(t, rss.Feeds{})
+	m.setupGlamour(80)
+
+	published := time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)
+	post := rss.Post{
+		Title:      "A post",
+		FeedTitle:  "Alpha",
+		Authors:    []string{"Ada", "Bob"},
+		Categories: []string{"go", " "},
+		Published:  published,
+		Updated:    published.AddDate(0, 0, 1),
+		Link:       "https://example.com/a-post",
+		Content:    "<p>" + strings.Repeat("word ", 450) + "</p>",
+	}
+
+	out := m.renderHeader(post)
+	for _, want := range []string{
+		"Alpha · by Ada, Bob",
+		"Published " + published.Format(m.cfg.DateFormat),
+		"3 min read",
+		"#go",
+		"https://example.com/a-post",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected header to contain %q, got %q", want, out)
+		}
+	}
+	if strings.Contains(out, "# ") {
+		t.Errorf("Expected blank categories to be skipped, got %q", out)
+	}
+
+	out = m.renderHeader(rss.Post{Title: "Bare"})
+	if lines := strings.Count(strings.TrimSpace(out), "\n"); lines != 0 {
+		t.Errorf("Expected only the title for a post without metadata, got %q", out)
+	}
+}
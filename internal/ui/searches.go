@@ -0,0 +1,191 @@
+package ui
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/isabelroses/izrss/internal/config"
+	"github.com/isabelroses/izrss/internal/rss"
+	"github.com/isabelroses/izrss/internal/storage"
+)
+
+// searchSymbol marks saved searches on the home view
+const searchSymbol = "⌕"
+
+// savedSearch is a search listed on the home view after the feeds, as a feed
+// of the posts it matches
+type savedSearch struct {
+	rss.Search
+	// fromConfig is set for the searches under [[searches]], which can only be
+	// changed in the config
+	fromConfig bool
+}
+
+// loadSearches reads the searches in the config, then those saved from the
+// UI. A saved search can't take the name of one in the config.
+func loadSearches(cfg *config.Config, db *storage.DB) []savedSearch {
+	searches := make([]savedSearch, 0, len(cfg.Searches))
+	names := make(map[string]bool, len(cfg.Searches))
+	for _, s := range cfg.Searches {
+		search, err := rss.ParseSearch(s.Name, s.Query)
+		if err != nil {
+			log.Printf("search %q: %v", s.Name, err)
+			continue
+		}
+		names[s.Name] = true
+		searches = append(searches, savedSearch{Search: search, fromConfig: true})
+	}
+
+	saved, err := db.LoadSearches()
+	if err != nil {
+		log.Printf("error loading saved searches: %v", err)
+	}
+	for _, s := range saved {
+		if names[s.Name] {
+			continue
+		}
+		search, err := rss.ParseSearch(s.Name, s.Query)
+		if err != nil {
+			log.Printf("saved search %q: %v", s.Name, err)
+			continue
+		}
+		searches = append(searches, savedSearch{Search: search})
+	}
+	return searches
+}
+
+// savedSearchAt returns the saved search on home view row id, which come after
+// the feeds' rows.
+func (m *Model) savedSearchAt(id int) (savedSearch, bool) {
+	i := id - len(m.context.feeds)
+	if i < 0 || i >= len(m.searches) {
+		return savedSearch{}, false
+	}
+	return m.searches[i], true
+}
+
+// searchFeed gathers the posts matching the saved search on home view row id
+// into a feed, keeping each post's place in its own feed.
+func (m *Model) searchFeed(id int) rss.Feed {
+	search, _ := m.savedSearchAt(id)
+	return rss.Feed{
+		Title: search.Name,
+		Posts: m.context.feeds.Search(search.Search, m.copies(), time.Now()),
+		ID:    id,
+	}
+}
+
+// listedPosts takes the current state of the posts listed, leaving out any
+// that a refresh has since removed.
+func (m *Model) listedPosts() []rss.Post {
+	posts := make([]rss.Post, 0, len(m.context.feed.Posts))
+	for _, post := range m.context.feed.Posts {
+		if post.FeedID >= len(m.context.feeds) || post.ID >= len(m.context.feeds[post.FeedID].Posts) {
+			continue
+		}
+		if current := m.context.feeds[post.FeedID].Posts[post.ID]; current.UUID == post.UUID {
+			posts = append(posts, current)
+		}
+	}
+	return posts
+}
+
+// homeFeed returns the feed on home view row id, or the feed of the saved
+// search there.
+func (m *Model) homeFeed(id int) rss.Feed {
+	if id < len(m.context.feeds) {
+		feed := m.context.feeds[id]
+		feed.ID = id
+		return feed
+	}
+	return m.searchFeed(id)
+}
+
+// homeRows is the number of rows on the home view: the feeds, then the saved
+// searches.
+func (m *Model) homeRows() int {
+	return len(m.context.feeds) + len(m.searches)
+}
+
+// startSavingSearch asks for a name to save query under, in place of the
+// search input.
+func (m *Model) startSavingSearch(query string) tea.Cmd {
+	if strings.TrimSpace(query) == "" {
+		return m.setStatus("Type a search to save first")
+	}
+	if _, err := rss.ParseSearch("", query); err != nil {
+		return m.setStatus(err.Error())
+	}
+
+	if m.context.curr != "search" {
+		m.swapPage("search")
+	}
+	m.context.saving = query
+	m.filter.Prompt = "Save as: "
+	m.filter.SetValue("")
+	m.filter.Focus()
+	m.table.Blur()
+	return nil
+}
+
+// stopSavingSearch puts the search input back as it was before saving.
+func (m *Model) stopSavingSearch() {
+	m.filter.Prompt = "Filter: "
+	m.filter.SetValue(m.context.saving)
+	m.filter.CursorEnd()
+	m.context.saving = ""
+}
+
+// saveSearch saves the search being named under name, and lists it on the
+// home view.
+func (m *Model) saveSearch(name string) tea.Cmd {
+	if name == "" {
+		return m.setStatus("A saved search needs a name")
+	}
+	for _, s := range m.searches {
+		if s.Name == name && s.fromConfig {
+			return m.setStatus(fmt.Sprintf("%q is a search in the config", name))
+		}
+	}
+
+	query := m.context.saving
+	if err := m.db.SaveSearch(name, query); err != nil {
+		log.Printf("error saving search: %v", err)
+		return m.setStatus("Could not save the search")
+	}
+	m.stopSavingSearch()
+	m.searches = loadSearches(m.cfg, m.db)
+
+	m.loadHome()
+	m.table.Focus()
+	m.filter.Blur()
+	for i, s := range m.searches {
+		if s.Name == name {
+			m.table.SetCursor(len(m.context.feeds) + i)
+		}
+	}
+	return m.setStatus(fmt.Sprintf("Saved search %q", name))
+}
+
+// deleteSearch removes the saved search on home view row id.
+func (m *Model) deleteSearch(id int) tea.Cmd {
+	search, ok := m.savedSearchAt(id)
+	if !ok {
+		return nil
+	}
+	if search.fromConfig {
+		return m.setStatus(fmt.Sprintf("%q can only be removed from the config", search.Name))
+	}
+
+	if err := m.db.DeleteSearch(search.Name); err != nil {
+		log.Printf("error deleting search: %v", err)
+		return m.setStatus("Could not delete the search")
+	}
+	m.searches = loadSearches(m.cfg, m.db)
+	m.loadHome()
+	return m.setStatus(fmt.Sprintf("Deleted search %q", search.Name))
+}
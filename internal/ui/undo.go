@@ -0,0 +1,207 @@
+package ui
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/isabelroses/izrss/internal/rss"
+)
+
+// maxUndo caps the undo stack; older actions fall off the bottom.
+const maxUndo = 50
+
+// postChange records a post's read or starred state from before an action
+// changed it. The indices are a hint: a refresh may move the post, so it is
+// matched back by feed URL and UUID.
+type postChange struct {
+	feedURL string
+	uuid    string
+	feedID  int
+	postID  int
+	// star is set for a change to the post's star rather than its read state
+	star bool
+	was  bool
+}
+
+type undoEntry struct {
+	desc    string
+	changes []postChange
+}
+
+// markPosts sets the read state of posts, pushing the previous states onto the
+// undo stack under desc.
+func (m *Model) markPosts(desc string, posts []rss.Post, read bool) {
+	m.pushUndo(desc, m.setPostsRead(posts, read))
+}
+
+// starPosts stars or unstars posts, pushing their previous states onto the
+// undo stack under desc.
+func (m *Model) starPosts(desc string, posts []rss.Post, starred bool) {
+	m.pushUndo(desc, m.setPostsStarred(posts, starred))
+}
+
+func (m *Model) pushUndo(desc string, changes []postChange) {
+	if len(changes) == 0 {
+		return
+	}
+
+	m.undo = append(m.undo, undoEntry{desc: desc, changes: changes})
+	if len(m.undo) > maxUndo {
+		m.undo = m.undo[len(m.undo)-maxUndo:]
+	}
+}
+
+// inFeeds reports whether a post copied out of m.context.feeds still points
+// at a post there
+func (m *Model) inFeeds(post rss.Post) bool {
+	return post.FeedID >= 0 && post.FeedID < len(m.context.feeds) &&
+		post.ID >= 0 && post.ID < len(m.context.feeds[post.FeedID].Posts)
+}
+
+// setPostsRead sets the read state of posts and their copies in other feeds
+// and saves it, returning the states it replaced. Posts already in that state
+// are left alone.
+func (m *Model) setPostsRead(posts []rss.Post, read bool) []postChange {
+	var (
+		changes []postChange
+		changed []rss.Post
+	)
+	for _, post := range m.copies().With(m.context.feeds, posts) {
+		if !m.inFeeds(post) {
+			continue
+		}
+		feed := m.context.feeds[post.FeedID]
+		if feed.Posts[post.ID].Read == read {
+			continue
+		}
+
+		changes = append(changes, postChange{
+			feedURL: feed.URL,
+			uuid:    post.UUID,
+			feedID:  post.FeedID,
+			postID:  post.ID,
+			was:     !read,
+		})
+		rss.SetRead(m.context.feeds, post.FeedID, post.ID, read)
+		changed = append(changed, post)
+	}
+
+	if len(changes) == 0 {
+		return nil
+	}
+
+	if err := m.context.feeds.WritePosts(m.db, changed); err != nil {
+		log.Printf("error writing tracking: %v", err)
+	}
+	return changes
+}
+
+// setPostsStarred stars or unstars posts and saves them, returning the states
+// it replaced, like setPostsRead.
+func (m *Model) setPostsStarred(posts []rss.Post, starred bool) []postChange {
+	var (
+		changes []postChange
+		changed []rss.Post
+	)
+	for _, post := range posts {
+		if !m.inFeeds(post) {
+			continue
+		}
+		feed := m.context.feeds[post.FeedID]
+		if feed.Posts[post.ID].Starred == starred {
+			continue
+		}
+
+		changes = append(changes, postChange{
+			feedURL: feed.URL,
+			uuid:    post.UUID,
+			feedID:  post.FeedID,
+			postID:  post.ID,
+			star:    true,
+			was:     !starred,
+		})
+		rss.SetStarred(m.context.feeds, post.FeedID, post.ID, starred)
+		changed = append(changed, post)
+	}
+
+	if len(changes) == 0 {
+		return nil
+	}
+
+	if err := m.context.feeds.WriteStars(m.db, changed); err != nil {
+		log.Printf("error writing stars: %v", err)
+	}
+	return changes
+}
+
+// undoLast reverts the most recent read or star action and describes what it did,
+// or returns an empty string when there is nothing to undo.
+func (m *Model) undoLast() string {
+	if len(m.undo) == 0 {
+		return ""
+	}
+
+	entry := m.undo[len(m.undo)-1]
+	m.undo = m.undo[:len(m.undo)-1]
+
+	var restored, restoredStars []rss.Post
+	for _, change := range entry.changes {
+		feedID, postID, ok := m.locate(change)
+		if !ok {
+			continue
+		}
+		open := m.context.post.FeedID == feedID && m.context.post.ID == postID
+
+		if change.star {
+			rss.SetStarred(m.context.feeds, feedID, postID, change.was)
+			restoredStars = append(restoredStars, m.context.feeds[feedID].Posts[postID])
+			if open {
+				m.context.post.Starred = change.was
+			}
+			continue
+		}
+
+		rss.SetRead(m.context.feeds, feedID, postID, change.was)
+		restored = append(restored, m.context.feeds[feedID].Posts[postID])
+		if open {
+			m.context.post.Read = change.was
+		}
+	}
+
+	if err := m.context.feeds.WritePosts(m.db, restored); err != nil {
+		log.Printf("error writing tracking: %v", err)
+	}
+	if err := m.context.feeds.WriteStars(m.db, restoredStars); err != nil {
+		log.Printf("error writing stars: %v", err)
+	}
+
+	if len(entry.changes) == 1 {
+		return fmt.Sprintf("Undid %s", entry.desc)
+	}
+	return fmt.Sprintf("Undid %s (%d posts)", entry.desc, len(entry.changes))
+}
+
+// locate finds the post a change refers to, trying its recorded position
+// before searching every feed.
+func (m *Model) locate(change postChange) (int, int, bool) {
+	feeds := m.context.feeds
+	if change.feedID < len(feeds) && change.postID < len(feeds[change.feedID].Posts) {
+		feed := feeds[change.feedID]
+		if feed.URL == change.feedURL && feed.Posts[change.postID].UUID == change.uuid {
+			return change.feedID, change.postID, true
+		}
+	}
+
+	for i, feed := range feeds {
+		if feed.URL != change.feedURL {
+			continue
+		}
+		for j, post := range feed.Posts {
+			if post.UUID == change.uuid {
+				return i, j, true
+			}
+		}
+	}
+
+	return 0, 0, false
+}
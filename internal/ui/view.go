@@ -13,15 +13,43 @@ func (m Model) View() string {
 	}
 
 	if m.context.curr == "reader" {
+		footer := m.footer()
+
+		// The reader leaves one line for the footer; give up more of the post
+		// while the full help is open.
+		vp := m.viewport
+		vp.Height -= lipgloss.Height(footer) - 1
+
+		header := fmt.Sprintf("%s - %3.f%%", m.context.post.Title, vp.ScrollPercent()*100)
+		body := vp.View()
+		if m.context.showLinks {
+			header = fmt.Sprintf("%s - %d links", m.context.post.Title, len(m.context.links))
+			body = m.linksView()
+		}
+
 		return m.styles.Main.Render(
 			lipgloss.JoinVertical(
 				lipgloss.Top,
-				fmt.Sprintf("%s - %3.f%%", m.context.post.Title, m.viewport.ScrollPercent()*100),
-				m.viewport.View(),
-				m.help.View(m.keys, m),
+				header,
+				body,
+				footer,
 			),
 		)
 	}
 
 	return m.styles.Main.Render(m.viewport.View())
 }
+
+// footer shows the transient status message if there is one, else the help,
+// followed by the progress of any downloads.
+func (m Model) footer() string {
+	footer := m.help.View(m.keys, m)
+	if m.status != "" {
+		footer = m.styles.Help.Render(m.status)
+	}
+
+	if len(m.downloads) > 0 {
+		footer = lipgloss.JoinHorizontal(lipgloss.Top, footer, m.styles.Help.Render("  "+m.downloadsView()))
+	}
+	return footer
+}
@@ -3,9 +3,11 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"log"
 	"os"
+	"time"
 
 	"github.com/alecthomas/kong"
 	tea "github.com/charmbracelet/bubbletea"
@@ -23,8 +25,29 @@ type CLI struct {
 	Config      string           `help:"The path to your config file."`
 	CountUnread bool             `help:"Count the number of unread posts."`
 	Version     kong.VersionFlag `help:"Print the version and exit."`
+
+	TUI    struct{}  `cmd:"" default:"1" hidden:"" help:"Open the reader."`
+	Export ExportCmd `cmd:"" help:"Export posts."`
+}
+
+// ExportCmd groups the export subcommands.
+type ExportCmd struct {
+	Posts ExportPostsCmd `cmd:"" help:"Export posts as Markdown files, an HTML digest or an EPUB book."`
 }
 
+// ExportPostsCmd exports the posts from the feed cache.
+type ExportPostsCmd struct {
+	Format string   `short:"f" help:"One of markdown, html or epub. Defaults to the config's export format."`
+	Output string   `short:"o" help:"The directory, or file for html and epub, to write to. Defaults to the config's export dir." type:"path"`
+	Feed   []string `help:"Only export posts from feeds with this URL or title. Can be repeated."`
+	Unread bool     `help:"Only export unread posts."`
+	Since  string   `help:"Only export posts published on or after this date (YYYY-MM-DD)."`
+	Title  string   `default:"izrss" help:"The title of the html digest or epub book."`
+}
+
+// cacheMaxAge is how long images and articles stay cached
+const cacheMaxAge = 30 * 24 * time.Hour
+
 const description = `An RSS feed reader for the terminal.
 
 The main bulk of customization is done via the "~/.config/izrss/config.toml"
@@ -42,17 +65,18 @@ func main() {
 		kong.UsageOnError(),
 	)
 
-	kctx.FatalIfErrorf(run(&cli))
+	kctx.FatalIfErrorf(run(&cli, kctx.Command()))
 }
 
-func run(cli *CLI) error {
+func run(cli *CLI, command string) error {
 	// Load configuration
 	cfg, err := config.Load(cli.Config)
 	if err != nil {
 		return fmt.Errorf("loading config: %w", err)
 	}
 
-	if len(cfg.Urls) == 0 {
+	urls := cfg.FeedURLs()
+	if len(urls) == 0 {
 		fmt.Println("No urls were found in config file, please add some and try again")
 		fmt.Println("You can find an example config file on the github page")
 		os.Exit(1)
@@ -65,10 +89,55 @@ func run(cli *CLI) error {
 	}
 	defer func() { _ = db.Close() }()
 
-	fetcher := rss.NewFetcher(db, cfg.DateFormat)
+	network := rss.Network{
+		UserAgent:      cfg.Network.UserAgent,
+		Proxy:          cfg.Network.Proxy,
+		FeedProxies:    cfg.FeedProxies(),
+		ConnectTimeout: time.Duration(cfg.Network.ConnectTimeout) * time.Second,
+		ReadTimeout:    time.Duration(cfg.Network.ReadTimeout) * time.Second,
+		CABundle:       cfg.Network.CABundle,
+		Insecure:       cfg.Network.Insecure,
+	}
+	retry := rss.Retry{Attempts: cfg.Network.Retries, BaseDelay: time.Second, MaxDelay: 30 * time.Second}
+	hostLimit := rss.HostLimit{
+		Concurrency: cfg.Network.PerHost,
+		Interval:    time.Duration(cfg.Network.HostDelay * float64(time.Second)),
+	}
+	rules, err := compileRules(cfg.Rules)
+	if err != nil {
+		return err
+	}
+	feedRules := make(map[string][]rss.Rule)
+	for _, feed := range cfg.Feeds {
+		if feedRules[feed.Source()], err = compileRules(feed.Rules); err != nil {
+			return fmt.Errorf("feed %s: %w", feed.Source(), err)
+		}
+	}
+
+	fetcher, err := rss.NewFetcher(db, cfg.DateFormat,
+		rss.WithNetwork(network),
+		rss.WithRetry(retry),
+		rss.WithHostLimit(hostLimit),
+		rss.WithCommandTimeouts(cfg.CommandTimeouts()),
+		rss.WithRules(rules, feedRules),
+		rss.WithCredentials(func(url string) (rss.Credentials, error) {
+			auth, err := cfg.Feed(url).Auth.Resolve()
+			if err != nil {
+				return rss.Credentials{}, fmt.Errorf("feed %s: %w", url, err)
+			}
+			return rss.Credentials{
+				Username: auth.Username,
+				Password: auth.Password,
+				Token:    auth.Token,
+				Headers:  auth.Headers,
+			}, nil
+		}))
+	if err != nil {
+		return fmt.Errorf("setting up the network: %w", err)
+	}
 
 	if cli.CountUnread {
-		feeds := fetcher.GetAllContent(cfg.Urls, true)
+		feeds := fetcher.GetAllContent(context.Background(), urls, rss.PreferCache)
 		if err := feeds.ReadTracking(db); err != nil {
 			return fmt.Errorf("reading tracking data: %w", err)
 		}
@@ -76,6 +145,16 @@ func run(cli *CLI) error {
 		return nil
 	}
 
+	if command == "export posts" {
+		return exportPosts(&cli.Export.Posts, cfg, db, fetcher)
+	}
+
+	// Images and articles are cached for the reader, and fetched again once
+	// they have been cached a while
+	if err := db.PruneCaches(time.Now().Add(-cacheMaxAge)); err != nil {
+		log.Printf("could not prune caches: %v", err)
+	}
+
 	m := ui.NewModel(cfg, db, fetcher)
 
 	// Buffer log output while the alt screen is active so stray errors can't
@@ -97,3 +176,17 @@ func run(cli *CLI) error {
 
 	return nil
 }
+
+// compileRules checks the rules in the config and compiles them for the
+// fetcher
+func compileRules(rules []config.Rule) ([]rss.Rule, error) {
+	compiled := make([]rss.Rule, 0, len(rules))
+	for _, rule := range rules {
+		r, err := rss.NewRule(rule.Field, rule.Match, rss.RuleAction(rule.Action), rule.Replace)
+		if err != nil {
+			return nil, fmt.Errorf("rule %q: %w", rule.Match, err)
+		}
+		compiled = append(compiled, r)
+	}
+	return compiled, nil
+}